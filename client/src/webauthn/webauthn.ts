@@ -8,6 +8,10 @@ const bufferEncode = (value: Uint8Array): string => {
     .replace(/=/g, "");;
 }
 
+const bufferDecode = (value: string): Uint8Array => {
+  return Uint8Array.from(atob(value.replace(/-/g, "+").replace(/_/g, "/")), c => c.charCodeAt(0));
+}
+
 interface AuthenticationResponse {
   accessKey: string;
 }
@@ -29,28 +33,44 @@ export const authenticate = async (identifier: string): Promise<AuthenticationRe
   const nextStep = response.headers.get('Next-Step');
   const registering = nextStep === 'register';
 
-  if (registering) {
-    await register(credentialsParams);
-  } else {
-    await login(credentialsParams);
-  }
+  const accessKey = registering
+    ? await register(credentialsParams, `${AUTHENTICATE_URL}/register`)
+    : await login(credentialsParams);
 
   return {
-    accessKey: ''
+    accessKey
   };
 }
 
-const register = async (createOptions: PublicKeyCredentialCreationOptions): Promise<void> => {
+export const addCredential = async (accessKey: string): Promise<AuthenticationResponse> => {
+  const headers = {
+    'Content-Type': 'application/json',
+    'Authorization': `Bearer ${accessKey}`,
+  };
+  const response = await fetch(`${AUTHENTICATE_URL}/credentials`, { method: 'POST', headers });
+  const credentialsParams = await response.json();
+
+  return {
+    accessKey: await register(credentialsParams, `${AUTHENTICATE_URL}/credentials/register`, headers)
+  };
+}
+
+const register = async (createOptions: PublicKeyCredentialCreationOptions, url: string, headers: Record<string, string> = { 'Content-Type': 'application/json' }): Promise<string> => {
   const credential = await navigator.credentials.create({
     publicKey: {
       ...createOptions,
       // @ts-ignore
-      challenge: Uint8Array.from(createOptions.challenge, c => c.charCodeAt(0)),
+      challenge: bufferDecode(createOptions.challenge),
       user: {
         ...createOptions.user,
         // @ts-ignore
-        id: Uint8Array.from(createOptions.user.id, c => c.charCodeAt(0)),
-      }
+        id: bufferDecode(createOptions.user.id),
+      },
+      excludeCredentials: (createOptions.excludeCredentials || []).map((credentials) => ({
+        ...credentials,
+        // @ts-ignore
+        id: Uint8Array.from(atob(credentials.id), c => c.charCodeAt(0)),
+      }))
     }
   });
 
@@ -59,18 +79,30 @@ const register = async (createOptions: PublicKeyCredentialCreationOptions): Prom
     // @ts-ignore
     const body = { id: credential.id, type: credential.type, rawId: bufferEncode(credential.rawId), response: { attestationObject: bufferEncode(credential.response.attestationObject), clientDataJSON: bufferEncode(credential.response.clientDataJSON) } };
   
-    await fetch(`${AUTHENTICATE_URL}/register`, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) });
+    const response = await fetch(url, { method: 'POST', headers, body: JSON.stringify(body) });
+    const { accessKey } = await response.json();
+    return accessKey;
   } else {
     throw new Error('Unknown error');
   }
 }
 
-const login = async (requestOptions: PublicKeyCredentialRequestOptions): Promise<void> => {
+export const conditionalLogin = async (): Promise<AuthenticationResponse> => {
+  const response = await fetch(`${AUTHENTICATE_URL}/conditional`, { method: 'POST' });
+  const requestOptions = await response.json();
+
+  return {
+    accessKey: await login(requestOptions, 'conditional')
+  };
+}
+
+const login = async (requestOptions: PublicKeyCredentialRequestOptions, mediation?: CredentialMediationRequirement): Promise<string> => {
   const assertion = await navigator.credentials.get({
+    mediation,
     publicKey: {
         ...requestOptions,
         // @ts-ignore
-        challenge: Uint8Array.from(requestOptions.challenge, c => c.charCodeAt(0)),
+        challenge: bufferDecode(requestOptions.challenge),
         allowCredentials: requestOptions.allowCredentials.map((credentials) => ({
           ...credentials,
           // @ts-ignore
@@ -99,7 +131,9 @@ const login = async (requestOptions: PublicKeyCredentialRequestOptions): Promise
       }
     };
 
-    await fetch(`${AUTHENTICATE_URL}/login`, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) });
+    const response = await fetch(`${AUTHENTICATE_URL}/login`, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) });
+    const { accessKey } = await response.json();
+    return accessKey;
   } else {
     throw new Error('Error');
   }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessKeyLifetime is the duration an access key issued after a ceremony can be used
+const AccessKeyLifetime = 15 * time.Minute
+
+// ErrInvalidAccessKey the access key is unknown or expired
+var ErrInvalidAccessKey = errors.New("Access key is invalid")
+
+// AccessKey proves that the user recently finished a ceremony, e.g. to add further credentials.
+type AccessKey struct {
+	Value      string
+	UserHandle []byte
+	Expires    time.Time
+}
+
+type AccessKeyRepository interface {
+	FindByValue(value string) (*AccessKey, error)
+	Create(accessKey *AccessKey) error
+}
+
+// NewAccessKey creates a random access key for the user.
+func NewAccessKey(user *User) (*AccessKey, error) {
+	value := make([]byte, 32)
+	_, err := rand.Read(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessKey{
+		Value:      base64.RawURLEncoding.EncodeToString(value),
+		UserHandle: user.Handle,
+		Expires:    time.Now().Add(AccessKeyLifetime),
+	}, nil
+}
+
+// accessKeyFromHeader returns the access key of an "Authorization: Bearer" header.
+func accessKeyFromHeader(header string) string {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+type InMemoryAccessKeyRepository struct {
+	mutex      sync.Mutex
+	accessKeys map[string]*AccessKey
+}
+
+func NewInMemoryAccessKeyRepository() *InMemoryAccessKeyRepository {
+	return &InMemoryAccessKeyRepository{
+		accessKeys: map[string]*AccessKey{},
+	}
+}
+
+func (repo *InMemoryAccessKeyRepository) FindByValue(value string) (*AccessKey, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	accessKey, ok := repo.accessKeys[value]
+	if !ok {
+		return nil, ErrInvalidAccessKey
+	}
+
+	if !time.Now().Before(accessKey.Expires) {
+		delete(repo.accessKeys, value)
+		return nil, ErrInvalidAccessKey
+	}
+	return accessKey, nil
+}
+
+// Create stores the access key and removes expired ones.
+func (repo *InMemoryAccessKeyRepository) Create(accessKey *AccessKey) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	now := time.Now()
+	for value, stored := range repo.accessKeys {
+		if !now.Before(stored.Expires) {
+			delete(repo.accessKeys, value)
+		}
+	}
+
+	repo.accessKeys[accessKey.Value] = accessKey
+	return nil
+}
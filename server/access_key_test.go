@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewAccessKey(t *testing.T) {
+	user := &User{Handle: []byte("alice")}
+
+	first, err := NewAccessKey(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewAccessKey(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first.Value) != 43 {
+		t.Fatalf("expected 32 random bytes encoded as 43 characters, got %d", len(first.Value))
+	}
+	if first.Value == second.Value {
+		t.Fatal("expected access keys to differ")
+	}
+	if string(first.UserHandle) != "alice" {
+		t.Fatalf("expected user handle 'alice', got '%s'", first.UserHandle)
+	}
+	if first.Expires.After(time.Now().Add(AccessKeyLifetime)) {
+		t.Fatalf("expected access key to expire within %s", AccessKeyLifetime)
+	}
+}
+
+func TestInMemoryAccessKeyRepository(t *testing.T) {
+	repo := NewInMemoryAccessKeyRepository()
+	valid := &AccessKey{Value: "valid", UserHandle: []byte("alice"), Expires: time.Now().Add(time.Minute)}
+	expired := &AccessKey{Value: "expired", UserHandle: []byte("alice"), Expires: time.Now().Add(-time.Second)}
+	for _, accessKey := range []*AccessKey{valid, expired} {
+		if err := repo.Create(accessKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := repo.FindByValue("valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != valid {
+		t.Fatal("expected the stored access key")
+	}
+
+	for _, value := range []string{"expired", "unknown", ""} {
+		_, err = repo.FindByValue(value)
+		if !errors.Is(err, ErrInvalidAccessKey) {
+			t.Fatalf("expected ErrInvalidAccessKey for '%s', got %v", value, err)
+		}
+	}
+}
+
+func TestInMemoryAccessKeyRepositoryRemovesExpiredKeys(t *testing.T) {
+	repo := NewInMemoryAccessKeyRepository()
+	repo.Create(&AccessKey{Value: "expired", Expires: time.Now().Add(-time.Second)})
+	repo.Create(&AccessKey{Value: "valid", Expires: time.Now().Add(time.Minute)})
+
+	if len(repo.accessKeys) != 1 {
+		t.Fatalf("expected only the valid access key to be kept, got %d", len(repo.accessKeys))
+	}
+}
+
+func TestAccessKeyFromHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer abc", "abc"},
+		{"", ""},
+		{"abc", ""},
+		{"Basic abc", ""},
+		{"bearer abc", ""},
+	}
+
+	for _, test := range tests {
+		if got := accessKeyFromHeader(test.header); got != test.want {
+			t.Errorf("accessKeyFromHeader(%q) = %q, expected %q", test.header, got, test.want)
+		}
+	}
+}
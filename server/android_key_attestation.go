@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AndroidKeyAttestationStatement struct {
+	Algorithm    int      `cbor:"alg"`
+	Signature    []byte   `cbor:"sig"`
+	Certificates [][]byte `cbor:"x5c"`
+}
+
+// OID of the Android Key Attestation extension holding the key description
+// See https://source.android.com/docs/security/features/keystore/attestation#attestation-extension
+var oidAndroidKeyDescription = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+
+// Values and tags of the Keymaster authorization list
+const (
+	kmOriginGenerated = 0
+	kmPurposeSign     = 2
+
+	kmTagPurpose         = 1
+	kmTagAllApplications = 600
+	kmTagOrigin          = 702
+)
+
+// AndroidKeyAttestationVerifier implements the verification procedure of the android-key attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-android-key-attestation
+type AndroidKeyAttestationVerifier struct {
+	// The Google hardware attestation roots; without them the attestation is not trusted
+	Roots *x509.CertPool
+	// Now returns the time used to validate certificates; defaults to time.Now
+	Now func() time.Time
+}
+
+func (verifier *AndroidKeyAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt AndroidKeyAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	credentialCertificate := certificates[0]
+
+	// Verify that sig is a valid signature over the concatenation of authenticatorData and clientDataHash
+	// using the public key in the first certificate in x5c with the algorithm specified in alg.
+	signedData := append(append([]byte{}, attestationObject.RawAuthnData...), clientDataHash...)
+	err = verifyAttestationSignature(credentialCertificate, COSEAlgorithmIdentifier(attStmt.Algorithm), signedData, attStmt.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that the public key in the first certificate in x5c matches the credentialPublicKey
+	// in the attestedCredentialData in authenticatorData.
+	publicKey, err := attestationObject.CredentialPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCertificatePublicKey(credentialCertificate, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDescription, err := parseAndroidKeyDescription(credentialCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = keyDescription.verify(clientDataHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without the Google roots, the chain can only be trusted through the metadata of the authenticator model
+	if verifier.Roots == nil {
+		return &AttestationResult{
+			Type:      AttestationTypeBasic,
+			TrustPath: certificates,
+		}, nil
+	}
+
+	err = verifyCertificateChain(certificates, verifier.Roots, verifier.now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationResult{
+		Type:      AttestationTypeBasic,
+		TrustPath: certificates,
+		Trusted:   true,
+	}, nil
+}
+
+func (verifier *AndroidKeyAttestationVerifier) now() time.Time {
+	if verifier.Now == nil {
+		return time.Now()
+	}
+	return verifier.Now()
+}
+
+// androidKeyDescription holds the fields of the KeyDescription sequence needed for attestation verification.
+type androidKeyDescription struct {
+	attestationChallenge []byte
+	softwareEnforced     androidAuthorizationList
+	teeEnforced          androidAuthorizationList
+}
+
+// androidAuthorizationList holds the fields of an AuthorizationList needed for attestation verification.
+type androidAuthorizationList struct {
+	purpose         []int
+	origin          *int
+	allApplications bool
+}
+
+func (description *androidKeyDescription) verify(clientDataHash []byte) error {
+	// Verify that the attestationChallenge field in the attestation certificate extension data is identical to clientDataHash.
+	if !bytes.Equal(description.attestationChallenge, clientDataHash) {
+		return errors.New("Android key attestation challenge does not match the client data hash")
+	}
+
+	// The AuthorizationList.allApplications field is not present on either authorization list,
+	// since PublicKeyCredential MUST be scoped to the RP ID.
+	if description.softwareEnforced.allApplications || description.teeEnforced.allApplications {
+		return errors.New("Android key must not be usable by all applications")
+	}
+
+	// The key has to be generated by the keystore and usable for signing, no matter whether the trusted execution
+	// environment or the keystore software enforces these authorizations, so the union of both lists is checked.
+	generated := false
+	for _, origin := range []*int{description.teeEnforced.origin, description.softwareEnforced.origin} {
+		if origin == nil {
+			continue
+		}
+		if *origin != kmOriginGenerated {
+			return errors.New("Android key must be generated by the keystore")
+		}
+		generated = true
+	}
+	if !generated {
+		return errors.New("Android key must be generated by the keystore")
+	}
+
+	purposes := append(append([]int{}, description.teeEnforced.purpose...), description.softwareEnforced.purpose...)
+	for _, purpose := range purposes {
+		if purpose == kmPurposeSign {
+			return nil
+		}
+	}
+	return errors.New("Android key purpose must be signing")
+}
+
+// parseAndroidKeyDescription parses the key description extension of the credential certificate.
+func parseAndroidKeyDescription(certificate *x509.Certificate) (*androidKeyDescription, error) {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidAndroidKeyDescription) {
+			continue
+		}
+
+		var raw struct {
+			AttestationVersion       int
+			AttestationSecurityLevel asn1.Enumerated
+			KeymasterVersion         int
+			KeymasterSecurityLevel   asn1.Enumerated
+			AttestationChallenge     []byte
+			UniqueID                 []byte
+			SoftwareEnforced         asn1.RawValue
+			TeeEnforced              asn1.RawValue
+		}
+		if _, err := asn1.Unmarshal(extension.Value, &raw); err != nil {
+			return nil, fmt.Errorf("Could not parse Android key description: %w", err)
+		}
+
+		softwareEnforced, err := parseAndroidAuthorizationList(raw.SoftwareEnforced.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		teeEnforced, err := parseAndroidAuthorizationList(raw.TeeEnforced.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		return &androidKeyDescription{
+			attestationChallenge: raw.AttestationChallenge,
+			softwareEnforced:     softwareEnforced,
+			teeEnforced:          teeEnforced,
+		}, nil
+	}
+	return nil, errors.New("Android key attestation certificate is missing the key description extension")
+}
+
+// parseAndroidAuthorizationList reads the relevant explicitly tagged fields of an AuthorizationList.
+// The list has many optional fields, which are skipped by their tag.
+func parseAndroidAuthorizationList(data []byte) (androidAuthorizationList, error) {
+	authorizations := androidAuthorizationList{}
+	for len(data) > 0 {
+		var field asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &field)
+		if err != nil {
+			return authorizations, fmt.Errorf("Could not parse Android authorization list: %w", err)
+		}
+		data = rest
+
+		switch field.Tag {
+		case kmTagPurpose:
+			var purpose []int
+			if _, err := asn1.UnmarshalWithParams(field.Bytes, &purpose, "set"); err != nil {
+				return authorizations, fmt.Errorf("Could not parse Android key purpose: %w", err)
+			}
+			authorizations.purpose = purpose
+		case kmTagAllApplications:
+			authorizations.allApplications = true
+		case kmTagOrigin:
+			var origin int
+			if _, err := asn1.Unmarshal(field.Bytes, &origin); err != nil {
+				return authorizations, fmt.Errorf("Could not parse Android key origin: %w", err)
+			}
+			authorizations.origin = &origin
+		}
+	}
+	return authorizations, nil
+}
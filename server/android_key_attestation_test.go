@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+// androidKeyTestVectors are android-key registrations of the FIDO conformance tools. Their chains end in an
+// intermediate of the fake Android keystore root, which is valid until 2045.
+var androidKeyTestVectors = []string{"android-key.json", "android-key-2.json"}
+
+// androidKeyTestRoots trusts the last certificate of the chain of the response.
+func androidKeyTestRoots(t *testing.T, response *AttestationResponse) *x509.CertPool {
+	t.Helper()
+
+	var attStmt AndroidKeyAttestationStatement
+	err := response.AttestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certificates[len(certificates)-1])
+	return roots
+}
+
+func TestAndroidKeyAttestation(t *testing.T) {
+	for _, vector := range androidKeyTestVectors {
+		t.Run(vector, func(t *testing.T) {
+			response := loadTestAttestation(t, vector)
+			verifier := &AndroidKeyAttestationVerifier{
+				Roots: androidKeyTestRoots(t, response),
+				Now:   func() time.Time { return time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC) },
+			}
+
+			attestation, err := verifier.Verify(&response.AttestationObject, response.ClientDataHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attestation.Type != AttestationTypeBasic || !attestation.Trusted {
+				t.Fatalf("expected trusted basic attestation, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+			}
+		})
+	}
+}
+
+func TestAndroidKeyAttestationWithExpiredChain(t *testing.T) {
+	response := loadTestAttestation(t, "android-key.json")
+	verifier := &AndroidKeyAttestationVerifier{
+		Roots: androidKeyTestRoots(t, response),
+		Now:   func() time.Time { return time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+
+	_, err := verifier.Verify(&response.AttestationObject, response.ClientDataHash)
+	if err == nil {
+		t.Fatal("expected expired certificate chain to be rejected")
+	}
+}
+
+func TestAndroidKeyAttestationWithoutRootsIsNotTrusted(t *testing.T) {
+	response := loadTestAttestation(t, "android-key.json")
+
+	attestation, err := (&AndroidKeyAttestationVerifier{}).Verify(&response.AttestationObject, response.ClientDataHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Trusted {
+		t.Fatal("expected attestation without configured roots not to be trusted")
+	}
+}
+
+func TestAndroidKeyAttestationOfOtherClientData(t *testing.T) {
+	response := loadTestAttestation(t, "android-key.json")
+	clientDataHash := append([]byte{}, response.ClientDataHash...)
+	clientDataHash[0] ^= 0xff
+
+	_, err := (&AndroidKeyAttestationVerifier{}).Verify(&response.AttestationObject, clientDataHash)
+	if err == nil {
+		t.Fatal("expected attestation of other client data to be rejected")
+	}
+}
+
+func TestAndroidKeyAuthorizationsOfBothListsAreCombined(t *testing.T) {
+	generated, imported := kmOriginGenerated, 2
+	challenge := []byte("client data hash")
+
+	tests := []struct {
+		name             string
+		softwareEnforced androidAuthorizationList
+		teeEnforced      androidAuthorizationList
+		valid            bool
+	}{
+		{"tee enforced", androidAuthorizationList{}, androidAuthorizationList{purpose: []int{kmPurposeSign}, origin: &generated}, true},
+		{"software enforced", androidAuthorizationList{purpose: []int{kmPurposeSign}, origin: &generated}, androidAuthorizationList{}, true},
+		{"purpose in software list", androidAuthorizationList{purpose: []int{kmPurposeSign}}, androidAuthorizationList{origin: &generated}, true},
+		{"origin in software list", androidAuthorizationList{origin: &generated}, androidAuthorizationList{purpose: []int{kmPurposeSign}}, true},
+		{"imported in software list", androidAuthorizationList{origin: &imported}, androidAuthorizationList{purpose: []int{kmPurposeSign}, origin: &generated}, false},
+		{"missing origin", androidAuthorizationList{purpose: []int{kmPurposeSign}}, androidAuthorizationList{}, false},
+		{"missing purpose", androidAuthorizationList{}, androidAuthorizationList{origin: &generated}, false},
+		{"all applications", androidAuthorizationList{allApplications: true}, androidAuthorizationList{purpose: []int{kmPurposeSign}, origin: &generated}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			description := &androidKeyDescription{
+				attestationChallenge: challenge,
+				softwareEnforced:     test.softwareEnforced,
+				teeEnforced:          test.teeEnforced,
+			}
+
+			err := description.verify(challenge)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected key description to be rejected")
+			}
+		})
+	}
+}
+
+func TestAndroidKeyDescriptionOfOtherChallenge(t *testing.T) {
+	generated := kmOriginGenerated
+	description := &androidKeyDescription{
+		attestationChallenge: []byte("client data hash"),
+		teeEnforced:          androidAuthorizationList{purpose: []int{kmPurposeSign}, origin: &generated},
+	}
+
+	err := description.verify([]byte("other client data hash"))
+	if err == nil {
+		t.Fatal("expected key description of another challenge to be rejected")
+	}
+}
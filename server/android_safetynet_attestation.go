@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AndroidSafetyNetAttestationStatement struct {
+	Version  string `cbor:"ver"`
+	Response []byte `cbor:"response"`
+}
+
+// SafetyNetResponse is the payload of a SafetyNet attestation JWS.
+// See https://developer.android.com/training/safetynet/attestation#compat-check-response
+type SafetyNetResponse struct {
+	Nonce                      string   `json:"nonce"`
+	TimestampMs                int64    `json:"timestampMs"`
+	ApkPackageName             string   `json:"apkPackageName"`
+	ApkCertificateDigestSha256 []string `json:"apkCertificateDigestSha256"`
+	CtsProfileMatch            bool     `json:"ctsProfileMatch"`
+	BasicIntegrity             bool     `json:"basicIntegrity"`
+}
+
+const (
+	safetyNetHostname = "attest.android.com"
+
+	defaultSafetyNetMaxAge    = time.Minute
+	defaultSafetyNetClockSkew = 10 * time.Second
+)
+
+// AndroidSafetyNetAttestationVerifier implements the verification procedure of the android-safetynet attestation
+// statement format.
+// See https://w3c.github.io/webauthn/#sctn-android-safetynet-attestation
+type AndroidSafetyNetAttestationVerifier struct {
+	// The roots the JWS certificate has to chain up to; defaults to the system roots
+	Roots *x509.CertPool
+	// Now returns the time used to validate the response timestamp and certificates; defaults to time.Now
+	Now func() time.Time
+	// MaxAge is how old a response may be; defaults to one minute
+	MaxAge time.Duration
+}
+
+func (verifier *AndroidSafetyNetAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt AndroidSafetyNetAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if attStmt.Version == "" {
+		return nil, errors.New("SafetyNet attestation version is missing")
+	}
+
+	jws, err := ParseJWS(attStmt.Response)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := parseCertificateChain(jws.Header.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	attestationCertificate := certificates[0]
+
+	err = jws.Verify(attestationCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that the SafetyNet response actually came from the SafetyNet service
+	err = attestationCertificate.VerifyHostname(safetyNetHostname)
+	if err != nil {
+		return nil, fmt.Errorf("SafetyNet attestation certificate is not issued to '%s': %w", safetyNetHostname, err)
+	}
+
+	now := verifier.now()
+	roots := verifier.Roots
+	if roots == nil {
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = verifyCertificateChain(certificates, roots, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var response SafetyNetResponse
+	err = json.Unmarshal(jws.Payload, &response)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse SafetyNet response: %w", err)
+	}
+
+	// Verify that the nonce attribute in the payload of response is identical to the Base64 encoding
+	// of the SHA-256 hash of the concatenation of authenticatorData and clientDataHash.
+	nonce := sha256.Sum256(append(append([]byte{}, attestationObject.RawAuthnData...), clientDataHash...))
+	if response.Nonce != base64.StdEncoding.EncodeToString(nonce[:]) {
+		return nil, errors.New("SafetyNet response nonce does not match the attested data")
+	}
+
+	if !response.CtsProfileMatch {
+		return nil, errors.New("SafetyNet response does not match the CTS profile")
+	}
+
+	err = verifier.verifyTimestamp(response.TimestampMs, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationResult{
+		Type:      AttestationTypeBasic,
+		TrustPath: certificates,
+		Trusted:   true,
+	}, nil
+}
+
+func (verifier *AndroidSafetyNetAttestationVerifier) verifyTimestamp(timestampMs int64, now time.Time) error {
+	maxAge := verifier.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultSafetyNetMaxAge
+	}
+
+	timestamp := time.UnixMilli(timestampMs)
+	if timestamp.After(now.Add(defaultSafetyNetClockSkew)) {
+		return fmt.Errorf("SafetyNet response timestamp %s lies in the future", timestamp)
+	}
+	if timestamp.Before(now.Add(-maxAge)) {
+		return fmt.Errorf("SafetyNet response timestamp %s is older than %s", timestamp, maxAge)
+	}
+	return nil
+}
+
+func (verifier *AndroidSafetyNetAttestationVerifier) now() time.Time {
+	if verifier.Now == nil {
+		return time.Now()
+	}
+	return verifier.Now()
+}
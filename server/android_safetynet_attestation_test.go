@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSafetyNetService signs SafetyNet responses with a certificate for attest.android.com issued by its own root.
+type testSafetyNetService struct {
+	roots       *x509.CertPool
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newTestSafetyNetService(t *testing.T) *testSafetyNetService {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test SafetyNet Root"}, true, rootKey, nil, nil)
+	key := newTestKey(t)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: safetyNetHostname},
+		DNSNames:     []string{safetyNetHostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &testSafetyNetService{roots: roots, key: key, certificate: certificate}
+}
+
+// attestation creates android-safetynet attestation statements of a valid response, which modify may change.
+func (service *testSafetyNetService) attestation(t *testing.T, modify func(response *SafetyNetResponse)) attestationStatementFunc {
+	return func(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+		nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+		response := &SafetyNetResponse{
+			Nonce:           base64.StdEncoding.EncodeToString(nonce[:]),
+			TimestampMs:     time.Now().UnixMilli(),
+			ApkPackageName:  "com.google.android.gms",
+			CtsProfileMatch: true,
+			BasicIntegrity:  true,
+		}
+		if modify != nil {
+			modify(response)
+		}
+
+		payload, err := json.Marshal(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jws := signTestJWS(t, "ES256", service.key, []*x509.Certificate{service.certificate}, payload)
+		return "android-safetynet", map[string]interface{}{"ver": "14799021", "response": jws}
+	}
+}
+
+func verifyTestSafetyNetAttestation(t *testing.T, verifier *AndroidSafetyNetAttestationVerifier, attStmt attestationStatementFunc) (*AttestationResult, error) {
+	t.Helper()
+
+	request := newTestAuthenticator(t).register([]byte("challenge"), FlagUserPresent, attStmt)
+	return verifier.Verify(&request.Response.AttestationObject, request.Response.ClientDataHash)
+}
+
+func TestSafetyNetAttestation(t *testing.T) {
+	service := newTestSafetyNetService(t)
+
+	attestation, err := verifyTestSafetyNetAttestation(t, &AndroidSafetyNetAttestationVerifier{Roots: service.roots}, service.attestation(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Type != AttestationTypeBasic || !attestation.Trusted {
+		t.Fatalf("expected trusted basic attestation, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+	}
+}
+
+func TestSafetyNetAttestationIsRejected(t *testing.T) {
+	service := newTestSafetyNetService(t)
+
+	tests := []struct {
+		name   string
+		modify func(response *SafetyNetResponse)
+		want   string
+	}{
+		{"wrong nonce", func(response *SafetyNetResponse) {
+			nonce := sha256.Sum256([]byte("other data"))
+			response.Nonce = base64.StdEncoding.EncodeToString(nonce[:])
+		}, "nonce"},
+		{"cts profile mismatch", func(response *SafetyNetResponse) {
+			response.CtsProfileMatch = false
+		}, "CTS profile"},
+		{"stale timestamp", func(response *SafetyNetResponse) {
+			response.TimestampMs = time.Now().Add(-2 * defaultSafetyNetMaxAge).UnixMilli()
+		}, "older than"},
+		{"future timestamp", func(response *SafetyNetResponse) {
+			response.TimestampMs = time.Now().Add(time.Minute).UnixMilli()
+		}, "in the future"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifyTestSafetyNetAttestation(t, &AndroidSafetyNetAttestationVerifier{Roots: service.roots}, service.attestation(t, test.modify))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected error about '%s', got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestSafetyNetAttestationWithInjectedTime(t *testing.T) {
+	service := newTestSafetyNetService(t)
+	later := time.Now().Add(2 * defaultSafetyNetMaxAge)
+
+	verifier := &AndroidSafetyNetAttestationVerifier{Roots: service.roots, Now: func() time.Time { return later }}
+	_, err := verifyTestSafetyNetAttestation(t, verifier, service.attestation(t, nil))
+	if err == nil {
+		t.Fatal("expected response to be stale at the injected time")
+	}
+
+	verifier.MaxAge = 3 * defaultSafetyNetMaxAge
+	_, err = verifyTestSafetyNetAttestation(t, verifier, service.attestation(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSafetyNetAttestationWithTamperedSignature(t *testing.T) {
+	service := newTestSafetyNetService(t)
+	attStmt := func(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+		format, statement := service.attestation(t, nil)(authData, clientDataHash)
+		parts := strings.Split(string(statement["response"].([]byte)), ".")
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		signature[len(signature)-1] ^= 0xff
+		parts[2] = base64.RawURLEncoding.EncodeToString(signature)
+		statement["response"] = []byte(strings.Join(parts, "."))
+		return format, statement
+	}
+
+	_, err := verifyTestSafetyNetAttestation(t, &AndroidSafetyNetAttestationVerifier{Roots: service.roots}, attStmt)
+	if err == nil || !strings.Contains(err.Error(), "JWS signature is invalid") {
+		t.Fatalf("expected tampered signature to be rejected, got %v", err)
+	}
+}
+
+func TestSafetyNetAttestationOfUnknownRoot(t *testing.T) {
+	service := newTestSafetyNetService(t)
+	otherRoots := newTestSafetyNetService(t).roots
+
+	_, err := verifyTestSafetyNetAttestation(t, &AndroidSafetyNetAttestationVerifier{Roots: otherRoots}, service.attestation(t, nil))
+	if err == nil {
+		t.Fatal("expected certificate of an unknown root to be rejected")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AppleAttestationStatement struct {
+	Certificates [][]byte `cbor:"x5c"`
+}
+
+// OID of the extension of the Apple anonymous attestation certificate carrying the nonce
+var oidAppleNonce = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+
+// AppleAttestationVerifier implements the verification procedure of the apple attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-apple-anonymous-attestation
+type AppleAttestationVerifier struct {
+	// The Apple WebAuthn root certificates; without them the attestation is not trusted
+	Roots *x509.CertPool
+	// Now returns the time used to validate certificates; defaults to time.Now
+	Now func() time.Time
+}
+
+func (verifier *AppleAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt AppleAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	credentialCertificate := certificates[0]
+
+	// Perform SHA-256 hash of the concatenation of authenticatorData and clientDataHash to produce nonce
+	// and verify that it equals the value of the extension in credCert.
+	nonce := sha256.Sum256(append(append([]byte{}, attestationObject.RawAuthnData...), clientDataHash...))
+	certificateNonce, err := parseAppleNonce(credentialCertificate)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(nonce[:], certificateNonce) {
+		return nil, errors.New("Apple attestation nonce does not match the attested data")
+	}
+
+	// Verify that the credential public key equals the Subject Public Key of credCert.
+	publicKey, err := attestationObject.CredentialPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCertificatePublicKey(credentialCertificate, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without the Apple root, the chain can only be trusted through the metadata of the authenticator model
+	if verifier.Roots == nil {
+		return &AttestationResult{
+			Type:      AttestationTypeAnonCA,
+			TrustPath: certificates,
+		}, nil
+	}
+
+	err = verifyCertificateChain(certificates, verifier.Roots, verifier.now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationResult{
+		Type:      AttestationTypeAnonCA,
+		TrustPath: certificates,
+		Trusted:   true,
+	}, nil
+}
+
+func (verifier *AppleAttestationVerifier) now() time.Time {
+	if verifier.Now == nil {
+		return time.Now()
+	}
+	return verifier.Now()
+}
+
+// parseAppleNonce reads the nonce from the Apple extension of the credential certificate.
+func parseAppleNonce(certificate *x509.Certificate) ([]byte, error) {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidAppleNonce) {
+			continue
+		}
+
+		var value struct {
+			Nonce []byte `asn1:"tag:1,explicit"`
+		}
+		if _, err := asn1.Unmarshal(extension.Value, &value); err != nil {
+			return nil, fmt.Errorf("Could not parse Apple attestation nonce: %w", err)
+		}
+		return value.Nonce, nil
+	}
+	return nil, errors.New("Apple attestation certificate is missing the nonce extension")
+}
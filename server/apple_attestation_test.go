@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// appleAttestation creates apple attestation statements with a credential certificate issued by the root,
+// carrying the nonce computed by nonceFunc from the attested data.
+func appleAttestation(t *testing.T, authenticator *testAuthenticator, root *x509.Certificate, rootKey *ecdsa.PrivateKey, nonceFunc func(authData []byte, clientDataHash []byte) []byte) attestationStatementFunc {
+	return func(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+		extension, err := asn1.Marshal(struct {
+			Nonce []byte `asn1:"tag:1,explicit"`
+		}{nonceFunc(authData, clientDataHash)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template := &x509.Certificate{
+			SerialNumber:    big.NewInt(time.Now().UnixNano()),
+			Subject:         pkix.Name{CommonName: "Test Credential"},
+			NotBefore:       time.Now().Add(-time.Hour),
+			NotAfter:        time.Now().Add(time.Hour),
+			ExtraExtensions: []pkix.Extension{{Id: oidAppleNonce, Value: extension}},
+		}
+		raw, err := x509.CreateCertificate(rand.Reader, template, root, &authenticator.key.PublicKey, rootKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "apple", map[string]interface{}{"x5c": [][]byte{raw}}
+	}
+}
+
+// appleNonce computes the nonce the way the authenticator does.
+func appleNonce(authData []byte, clientDataHash []byte) []byte {
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	return nonce[:]
+}
+
+func verifyTestAppleAttestation(t *testing.T, verifier *AppleAttestationVerifier, attStmt func(*testAuthenticator) attestationStatementFunc) (*AttestationResult, error) {
+	t.Helper()
+
+	authenticator := newTestAuthenticator(t)
+	request := authenticator.register([]byte("challenge"), FlagUserPresent, attStmt(authenticator))
+	return verifier.Verify(&request.Response.AttestationObject, request.Response.ClientDataHash)
+}
+
+func TestAppleAttestation(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Apple Root"}, true, rootKey, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	attStmt := func(authenticator *testAuthenticator) attestationStatementFunc {
+		return appleAttestation(t, authenticator, root, rootKey, appleNonce)
+	}
+
+	attestation, err := verifyTestAppleAttestation(t, &AppleAttestationVerifier{}, attStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Type != AttestationTypeAnonCA || attestation.Trusted {
+		t.Fatalf("expected untrusted anonca attestation without roots, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+	}
+
+	attestation, err = verifyTestAppleAttestation(t, &AppleAttestationVerifier{Roots: roots}, attStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Type != AttestationTypeAnonCA || !attestation.Trusted {
+		t.Fatalf("expected trusted anonca attestation, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+	}
+
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(newTestCertificate(t, pkix.Name{CommonName: "Other Root"}, true, newTestKey(t), nil, nil))
+	_, err = verifyTestAppleAttestation(t, &AppleAttestationVerifier{Roots: otherRoots}, attStmt)
+	if err == nil {
+		t.Fatal("expected certificate of an unknown root to be rejected")
+	}
+}
+
+func TestAppleAttestationWithWrongNonce(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Apple Root"}, true, rootKey, nil, nil)
+
+	_, err := verifyTestAppleAttestation(t, &AppleAttestationVerifier{}, func(authenticator *testAuthenticator) attestationStatementFunc {
+		return appleAttestation(t, authenticator, root, rootKey, func(authData []byte, clientDataHash []byte) []byte {
+			return appleNonce(authData, []byte("other client data"))
+		})
+	})
+	if err == nil {
+		t.Fatal("expected nonce of other client data to be rejected")
+	}
+}
+
+func TestAppleAttestationWithOtherCredentialKey(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Apple Root"}, true, rootKey, nil, nil)
+
+	_, err := verifyTestAppleAttestation(t, &AppleAttestationVerifier{}, func(authenticator *testAuthenticator) attestationStatementFunc {
+		return appleAttestation(t, newTestAuthenticator(t), root, rootKey, appleNonce)
+	})
+	if err == nil {
+		t.Fatal("expected certificate of another key to be rejected")
+	}
+}
+
+func TestRegisterWithAppleAttestationWithoutRoots(t *testing.T) {
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.Attestation.Conveyance = AttestationConveyanceDirect
+	})
+	webauthn.RegisterAttestationFormat("apple", &AppleAttestationVerifier{})
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Apple Root"}, true, rootKey, nil, nil)
+
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, appleAttestation(t, authenticator, root, rootKey, appleNonce))
+
+	if user.Credentials[0].AttestationType != AttestationTypeSelf {
+		t.Fatalf("expected untrusted attestation to be treated as self attestation, got %s", user.Credentials[0].AttestationType)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AttestationType describes which kind of attestation an authenticator provided for a credential.
+// See https://w3c.github.io/webauthn/#sctn-attestation-types
+type AttestationType string
+
+const (
+	// AttestationTypeNone no attestation information is available
+	AttestationTypeNone AttestationType = "none"
+	// AttestationTypeSelf the credential private key signed the attestation itself
+	AttestationTypeSelf AttestationType = "self"
+	// AttestationTypeBasic an attestation key pair shared by a batch of authenticators signed the attestation
+	AttestationTypeBasic AttestationType = "basic"
+	// AttestationTypeAttCA an attestation CA issued a certificate for an authenticator specific attestation key
+	AttestationTypeAttCA AttestationType = "attca"
+	// AttestationTypeAnonCA an anonymization CA issued a certificate for a credential specific attestation key
+	AttestationTypeAnonCA AttestationType = "anonca"
+)
+
+// AttestationConveyancePreference tells the authenticator whether and how attestation should be conveyed.
+// See https://w3c.github.io/webauthn/#enum-attestation-convey
+type AttestationConveyancePreference string
+
+const (
+	AttestationConveyanceNone       AttestationConveyancePreference = "none"
+	AttestationConveyanceIndirect   AttestationConveyancePreference = "indirect"
+	AttestationConveyanceDirect     AttestationConveyancePreference = "direct"
+	AttestationConveyanceEnterprise AttestationConveyancePreference = "enterprise"
+)
+
+// ErrAttestationRequired is returned for none attestations when the relying party requires attestation.
+var ErrAttestationRequired = errors.New("Attestation is required, but the authenticator provided none")
+
+// AttestationResult is the outcome of verifying an attestation statement.
+type AttestationResult struct {
+	Type AttestationType
+	// The certificates of the x5c chain, starting with the attestation certificate
+	TrustPath []*x509.Certificate
+	// The metadata of the authenticator model, if it is known to the metadata service
+	Metadata *MetadataEntry
+	// Whether the trust path chains up to a configured or metadata root; until then, the type is only claimed
+	Trusted bool
+}
+
+// VerifiedType returns the attestation type that is backed by a trusted root. An attestation whose trust path
+// could not be verified only proves possession of the credential private key, just like self attestation.
+func (result *AttestationResult) VerifiedType() AttestationType {
+	if len(result.TrustPath) > 0 && !result.Trusted {
+		return AttestationTypeSelf
+	}
+	return result.Type
+}
+
+// AttestationVerifier verifies attestation statements of a single attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-defined-attestation-formats
+type AttestationVerifier interface {
+	Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error)
+}
+
+// ErrUnsupportedAttestationFormat is returned for attestation statements no verifier is registered for.
+var ErrUnsupportedAttestationFormat = errors.New("Attestation format is not supported")
+
+// AttestationFormats is a registry of attestation verifiers keyed by their attestation statement format identifier.
+type AttestationFormats map[string]AttestationVerifier
+
+// DefaultAttestationFormats returns a registry containing all attestation formats implemented by this package.
+func DefaultAttestationFormats() AttestationFormats {
+	return AttestationFormats{
+		"none":              &NoneAttestationVerifier{},
+		"packed":            &PackedAttestationVerifier{},
+		"fido-u2f":          &FIDOU2FAttestationVerifier{},
+		"tpm":               &TPMAttestationVerifier{},
+		"android-key":       &AndroidKeyAttestationVerifier{},
+		"android-safetynet": &AndroidSafetyNetAttestationVerifier{},
+		"apple":             &AppleAttestationVerifier{},
+	}
+}
+
+// Register adds a verifier for the given format, replacing any verifier registered for it before.
+func (formats AttestationFormats) Register(format string, verifier AttestationVerifier) {
+	formats[format] = verifier
+}
+
+// Verify dispatches the attestation object to the verifier registered for its format.
+func (formats AttestationFormats) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	verifier, ok := formats[attestationObject.Fmt]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedAttestationFormat, attestationObject.Fmt)
+	}
+	return verifier.Verify(attestationObject, clientDataHash)
+}
+
+// OID of the FIDO extension carrying the AAGUID of an authenticator in its attestation certificate
+// See https://w3c.github.io/webauthn/#sctn-packed-attestation-cert-requirements
+var oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// parseCertificateChain parses the DER encoded certificates of an x5c array.
+func parseCertificateChain(x5c [][]byte) ([]*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, errors.New("Certificate chain is empty")
+	}
+
+	certificates := make([]*x509.Certificate, 0, len(x5c))
+	for i, raw := range x5c {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse certificate %d of chain: %w", i, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// verifyAttestationSignature verifies sig over data with the public key of the attestation certificate
+// using the given COSE algorithm.
+func verifyAttestationSignature(certificate *x509.Certificate, algorithm COSEAlgorithmIdentifier, data []byte, sig []byte) error {
+	if algorithm == AlgRS1 {
+		// The x509 package refuses SHA-1 signatures, but TPMs still commonly produce them
+		key, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("Attestation certificate does not contain an RSA public key")
+		}
+		digest := sha1.Sum(data)
+		err := rsa.VerifyPKCS1v15(key, crypto.SHA1, digest[:], sig)
+		if err != nil {
+			return fmt.Errorf("Attestation signature is invalid: %w", err)
+		}
+		return nil
+	}
+
+	err := certificate.CheckSignature(x509.SignatureAlgorithm(SigAlgFromCOSEAlg(algorithm)), data, sig)
+	if err != nil {
+		return fmt.Errorf("Attestation signature is invalid: %w", err)
+	}
+	return nil
+}
+
+// verifyCertificateAAGUID checks the id-fido-gen-ce-aaguid extension of an attestation certificate.
+// The extension is optional, but if present it must not be critical and must match the AAGUID
+// found in the authenticator data.
+func verifyCertificateAAGUID(certificate *x509.Certificate, aaguid []byte) error {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+
+		if extension.Critical {
+			return errors.New("AAGUID extension of attestation certificate must not be critical")
+		}
+
+		var certificateAAGUID []byte
+		if _, err := asn1.Unmarshal(extension.Value, &certificateAAGUID); err != nil {
+			return fmt.Errorf("Could not parse AAGUID extension of attestation certificate: %w", err)
+		}
+
+		if !bytes.Equal(certificateAAGUID, aaguid) {
+			return fmt.Errorf("AAGUID of attestation certificate does not match; expected %x, got %x", aaguid, certificateAAGUID)
+		}
+	}
+	return nil
+}
+
+// ErrNoTrustAnchor is returned when a certificate chain is verified without any root certificate to trust.
+var ErrNoTrustAnchor = errors.New("No root certificate configured to verify the certificate chain")
+
+// verifyCertificateChain checks that the certificates of a trust path chain up to one of the roots at the given
+// time. The chain itself is never trusted, so roots are required.
+func verifyCertificateChain(certificates []*x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	if len(certificates) == 0 {
+		return errors.New("Certificate chain is empty")
+	}
+
+	if roots == nil {
+		return ErrNoTrustAnchor
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	// TPM AIK certificates mark their subject alternative name critical, but it only contains a directory
+	// name, which the x509 package does not handle. It is checked by the TPM attestation verifier instead.
+	leaf := *certificates[0]
+	leaf.UnhandledCriticalExtensions = nil
+	for _, extension := range certificates[0].UnhandledCriticalExtensions {
+		if !extension.Equal(oidExtensionSubjectAltName) {
+			leaf.UnhandledCriticalExtensions = append(leaf.UnhandledCriticalExtensions, extension)
+		}
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("Certificate chain could not be verified: %w", err)
+	}
+	return nil
+}
+
+// verifyCertificatePublicKey checks that the certificate certifies the credential public key.
+func verifyCertificatePublicKey(certificate *x509.Certificate, publicKey PublicKey) error {
+	credentialKey, err := ToCryptoPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	certificateKey, ok := certificate.PublicKey.(interface {
+		Equal(crypto.PublicKey) bool
+	})
+	if !ok || !certificateKey.Equal(credentialKey) {
+		return errors.New("Certificate public key does not match the credential public key")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 
 	"github.com/fxamacker/cbor"
 )
@@ -12,6 +13,7 @@ type AttestationResponse struct {
 	AttestationObject AttestationObject
 	ClientData        ClientData
 	VerificationData  []byte
+	ClientDataHash    []byte
 	PublicKey         PublicKey
 }
 
@@ -39,7 +41,8 @@ func (response *AttestationResponse) UnmarshalJSON(b []byte) error {
 
 	hash := sha256.New()
 	hash.Write(rawResponse.ClientDataJSON)
-	response.VerificationData = append(response.AttestationObject.RawAuthnData, hash.Sum(nil)...)
+	response.ClientDataHash = hash.Sum(nil)
+	response.VerificationData = append(response.AttestationObject.RawAuthnData, response.ClientDataHash...)
 
 	key, err := ParsePublicKey(response.AttestationObject.AuthnData.AttData.CredentialPublicKey)
 	response.PublicKey = key
@@ -72,19 +75,18 @@ type ClientData struct {
 	Type      string `json:"type"`
 	Challenge string `json:"challenge"`
 	Origin    string `json:"origin"`
+	// Set if the ceremony ran in an iframe whose origin differs from its ancestors
+	CrossOrigin bool `json:"crossOrigin"`
+	// Origin of the top level document if the ceremony ran in an iframe
+	TopOrigin string `json:"topOrigin"`
 }
 
 type AttestationObject struct {
 	AuthnData    AuthenticatorData
 	RawAuthnData []byte
 	Fmt          string
-	AttStmt      PackedAttestationStatement
-}
-
-type PackedAttestationStatement struct {
-	Algorithm   int    `cbor:"alg"`
-	Signature   []byte `cbor:"sig"`
-	Certificate []byte `cbor:"x5c,omitifempty"`
+	// The raw CBOR encoded attestation statement; its structure depends on Fmt
+	AttStmt cbor.RawMessage
 }
 
 func (attestationObject *AttestationObject) UnmarshalCBOR(b []byte) error {
@@ -105,15 +107,23 @@ func (attestationObject *AttestationObject) UnmarshalCBOR(b []byte) error {
 	}
 	attestationObject.AuthnData = authData
 
-	var attStmt PackedAttestationStatement
-	err = cbor.Unmarshal(rawResponse.AttStmt, &attStmt)
-	if err != nil {
-		return err
-	}
-	attestationObject.AttStmt = attStmt
-
+	attestationObject.AttStmt = rawResponse.AttStmt
 	attestationObject.RawAuthnData = rawResponse.AuthnData
 	attestationObject.Fmt = rawResponse.Fmt
 
 	return nil
 }
+
+// DecodeAttStmt decodes the attestation statement into the structure of its format.
+func (attestationObject *AttestationObject) DecodeAttStmt(attStmt interface{}) error {
+	err := cbor.Unmarshal(attestationObject.AttStmt, attStmt)
+	if err != nil {
+		return fmt.Errorf("Could not decode '%s' attestation statement: %w", attestationObject.Fmt, err)
+	}
+	return nil
+}
+
+// CredentialPublicKey parses the credential public key contained in the attested credential data.
+func (attestationObject *AttestationObject) CredentialPublicKey() (PublicKey, error) {
+	return ParsePublicKey(attestationObject.AuthnData.AttData.CredentialPublicKey)
+}
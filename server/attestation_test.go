@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestAttestation reads a registration response recorded from a real authenticator from testdata.
+func loadTestAttestation(t testing.TB, name string) *AttestationResponse {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request RegisterRequest
+	err = json.Unmarshal(raw, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &request.Response
+}
+
+// newTestKey generates a P-256 key for test certificates.
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestCertificate issues a certificate for the key, signed by the parent or self-signed if parent is nil.
+func newTestCertificate(t *testing.T, subject pkix.Name, isCA bool, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+// packedAttestationSubject is a subject fulfilling the packed attestation certificate requirements.
+var packedAttestationSubject = pkix.Name{
+	Country:            []string{"DE"},
+	Organization:       []string{"Test Authenticators"},
+	OrganizationalUnit: []string{attestationCertificateOU},
+	CommonName:         "Test Authenticator",
+}
+
+// packedAttestation creates packed attestation statements signed with the key of the first certificate.
+func packedAttestation(t *testing.T, key *ecdsa.PrivateKey, certificates ...*x509.Certificate) attestationStatementFunc {
+	return func(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+		digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x5c := [][]byte{}
+		for _, certificate := range certificates {
+			x5c = append(x5c, certificate.Raw)
+		}
+		return "packed", map[string]interface{}{"alg": int(AlgES256), "sig": signature, "x5c": x5c}
+	}
+}
+
+func TestPackedAttestationWithSelfSignedCertificateIsNotTrusted(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	attestationKey := newTestKey(t)
+	forged := newTestCertificate(t, packedAttestationSubject, false, attestationKey, nil, nil)
+
+	request := authenticator.register([]byte("challenge"), FlagUserPresent, packedAttestation(t, attestationKey, forged))
+	response := request.Response
+
+	attestation, err := (&PackedAttestationVerifier{}).Verify(&response.AttestationObject, response.ClientDataHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Type != AttestationTypeBasic || attestation.Trusted {
+		t.Fatalf("expected untrusted basic attestation, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+	}
+}
+
+func TestVerifyPackedCertificate(t *testing.T) {
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		valid       bool
+	}{
+		{"valid", &x509.Certificate{Version: 3, Subject: packedAttestationSubject, BasicConstraintsValid: true}, true},
+		{"version 1", &x509.Certificate{Version: 1, Subject: packedAttestationSubject, BasicConstraintsValid: true}, false},
+		{"missing subject", &x509.Certificate{Version: 3, Subject: pkix.Name{CommonName: "Test Authenticator"}, BasicConstraintsValid: true}, false},
+		{"CA certificate", &x509.Certificate{Version: 3, Subject: packedAttestationSubject, BasicConstraintsValid: true, IsCA: true}, false},
+		{"missing basic constraints", &x509.Certificate{Version: 3, Subject: packedAttestationSubject}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyPackedCertificate(test.certificate)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected attestation certificate to be rejected")
+			}
+		})
+	}
+}
+
+func TestRegisterWithUntrustedAttestationIsTreatedAsSelfAttestation(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	attestationKey := newTestKey(t)
+	forged := newTestCertificate(t, packedAttestationSubject, false, attestationKey, nil, nil)
+
+	user := registerTestUser(t, webauthn, authenticator, packedAttestation(t, attestationKey, forged))
+
+	if user.Credentials[0].AttestationType != AttestationTypeSelf {
+		t.Fatalf("expected self attestation, got %s", user.Credentials[0].AttestationType)
+	}
+}
+
+func TestSelfSignedCertificateChainIsNotTrusted(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Forged Root"}, true, rootKey, nil, nil)
+	leaf := newTestCertificate(t, packedAttestationSubject, false, newTestKey(t), root, rootKey)
+	chain := []*x509.Certificate{leaf, root}
+
+	err := verifyCertificateChain(chain, nil, time.Now())
+	if !errors.Is(err, ErrNoTrustAnchor) {
+		t.Fatalf("expected ErrNoTrustAnchor, got %v", err)
+	}
+
+	otherRoot := newTestCertificate(t, pkix.Name{CommonName: "Trusted Root"}, true, newTestKey(t), nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(otherRoot)
+	err = verifyCertificateChain(chain, roots, time.Now())
+	if err == nil {
+		t.Fatal("expected chain of an unknown root to be rejected")
+	}
+
+	roots.AddCert(root)
+	err = verifyCertificateChain(chain, roots, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEventType identifies security relevant events worth recording.
+type AuditEventType string
+
+const (
+	// AuditSignCountRegression the signature counter of a credential did not increase
+	AuditSignCountRegression AuditEventType = "sign_count_regression"
+)
+
+type AuditEvent struct {
+	Type         AuditEventType   `json:"type"`
+	Time         time.Time        `json:"time"`
+	UserHandle   URLEncodedBase64 `json:"userHandle"`
+	CredentialId URLEncodedBase64 `json:"credentialId"`
+	Message      string           `json:"message"`
+}
+
+// AuditLogger records audit events.
+type AuditLogger interface {
+	Log(event AuditEvent)
+}
+
+// StdoutAuditLogger writes audit events as JSON lines to stdout.
+type StdoutAuditLogger struct{}
+
+func (logger *StdoutAuditLogger) Log(event AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("AUDIT", string(line))
+}
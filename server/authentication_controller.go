@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,13 +11,13 @@ import (
 
 type AuthenticationController struct {
 	userRepo      UserRepository
-	challengeRepo ChallengeRepository
+	accessKeyRepo AccessKeyRepository
 	webauthn      *WebAuthn
 }
 
-func (controller *AuthenticationController) Init(userRepo UserRepository, challengeRepo ChallengeRepository, webauthn *WebAuthn) {
+func (controller *AuthenticationController) Init(userRepo UserRepository, accessKeyRepo AccessKeyRepository, webauthn *WebAuthn) {
 	controller.userRepo = userRepo
-	controller.challengeRepo = challengeRepo
+	controller.accessKeyRepo = accessKeyRepo
 	controller.webauthn = webauthn
 }
 
@@ -32,19 +31,47 @@ func (controller *AuthenticationController) Authenticate(c *gin.Context) {
 		return
 	}
 
-	user, _ := controller.userRepo.FindByIdentifier(body.Identifier)
+	var user *User
+	if body.Identifier != "" {
+		user, _ = controller.userRepo.FindByIdentifier(body.Identifier)
+	}
 
 	var response interface{}
-	if user != nil {
-		response = controller.webauthn.BeginLogin(user)
-		c.Header("Next-Step", "login")
+	var err error
+	nextStep := "register"
+	if body.Identifier == "" {
+		// Without an identifier the user logs in with a discoverable credential
+		response, err = controller.webauthn.BeginDiscoverableLogin()
+		nextStep = "login"
+	} else if user != nil {
+		response, err = controller.webauthn.BeginLogin(user)
+		nextStep = "login"
 	} else {
-		response = controller.webauthn.BeginRegister(&User{
+		displayName := body.DisplayName
+		if displayName == "" {
+			displayName = body.Identifier
+		}
+		response, err = controller.webauthn.BeginRegister(&User{
 			Credentials: []Credential{},
 			Identifier:  body.Identifier,
+			DisplayName: displayName,
+		})
+	}
+	if errors.Is(err, ErrTooManyChallenges) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "too many outstanding challenges",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "could not create challenge",
 		})
-		c.Header("Next-Step", "register")
+		fmt.Println(err)
+		return
 	}
+
+	c.Header("Next-Step", nextStep)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -60,6 +87,21 @@ func (controller *AuthenticationController) Register(c *gin.Context) {
 	}
 
 	user, err := controller.webauthn.FinishRegister(body)
+	var rejection *RegistrationRejection
+	if errors.As(err, &rejection) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "registration rejected by policy",
+			"reason":  rejection.Reason,
+		})
+		fmt.Println(err)
+		return
+	}
+	if errors.Is(err, ErrCredentialAlreadyRegistered) {
+		c.JSON(http.StatusConflict, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "could not validate registration",
@@ -77,7 +119,7 @@ func (controller *AuthenticationController) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	controller.respondCeremonyResult(c, user, &user.Credentials[0])
 }
 
 func (controller *AuthenticationController) Login(c *gin.Context) {
@@ -91,18 +133,35 @@ func (controller *AuthenticationController) Login(c *gin.Context) {
 	}
 
 	// Implementation of https://w3c.github.io/webauthn/#sctn-verifying-assertion
-	challengeId, _ := base64.RawStdEncoding.DecodeString(body.Response.ClientData.Challenge)
-	challenge, err := controller.challengeRepo.FindByValue(string(challengeId))
+	session, err := controller.webauthn.ConsumeSession(body.Response.ClientData, CeremonyAuthentication)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
-			"error": errors.New("no valid challenge found"),
+			"error": "no valid challenge found",
+		})
+		return
+	}
+
+	// Logins without an identifier resolve the user by the credential; FinishLogin checks the user handle
+	var user *User
+	if len(session.UserHandle) > 0 {
+		user, err = controller.userRepo.FindByHandle(session.UserHandle)
+	} else {
+		user, err = controller.userRepo.FindByCredentialId(body.RawId)
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": ErrUnknownCredential.Error(),
 		})
 		return
 	}
 
-	// Implementation of https://w3c.github.io/webauthn/#sctn-registering-a-new-credential
-	l := challenge.Response.(LoginResponse)
-	user, err := controller.userRepo.FindByIdentifier(body.Response.UserHandle)
+	credential, err := controller.webauthn.FinishLogin(&body, session, user)
+	if errors.Is(err, ErrUnknownCredential) || errors.Is(err, ErrCredentialNotAllowed) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -110,19 +169,172 @@ func (controller *AuthenticationController) Login(c *gin.Context) {
 		return
 	}
 
-	err = controller.webauthn.FinishLogin(&body, &l, user)
+	err = controller.userRepo.UpdateCredential(credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "could not store credential data",
+		})
+		fmt.Println(err)
+		return
+	}
+
+	controller.respondCeremonyResult(c, user, credential)
+}
+
+// BeginConditionalLogin issues a login challenge for passkey autofill on the sign-in page, which is not
+// tied to any identifier.
+func (controller *AuthenticationController) BeginConditionalLogin(c *gin.Context) {
+	response, err := controller.webauthn.BeginConditionalLogin()
+	if errors.Is(err, ErrTooManyChallenges) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "too many outstanding challenges",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "could not create challenge",
+		})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BeginAddCredential starts the registration of another credential for the user of the access key.
+func (controller *AuthenticationController) BeginAddCredential(c *gin.Context) {
+	user := controller.authenticatedUser(c)
+	if user == nil {
+		return
+	}
+
+	response, err := controller.webauthn.BeginAddCredential(user)
+	if errors.Is(err, ErrTooManyChallenges) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "too many outstanding challenges",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "could not create challenge",
+		})
+		fmt.Println(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AddCredential finishes the registration of another credential for the user of the access key.
+func (controller *AuthenticationController) AddCredential(c *gin.Context) {
+	user := controller.authenticatedUser(c)
+	if user == nil {
+		return
+	}
+
+	body := RegisterRequest{}
+	err := json.NewDecoder(c.Request.Body).Decode(&body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
+			"message": "could not parse body",
+		})
+		fmt.Println("Error", err)
+		return
+	}
+
+	credential, err := controller.webauthn.FinishAddCredential(body, user)
+	var rejection *RegistrationRejection
+	if errors.As(err, &rejection) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "registration rejected by policy",
+			"reason":  rejection.Reason,
+		})
+		fmt.Println(err)
+		return
+	}
+	if errors.Is(err, ErrCredentialAlreadyRegistered) {
+		c.JSON(http.StatusConflict, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "could not validate registration",
+		})
+		fmt.Println(err)
+		return
+	}
+
+	err = controller.userRepo.AddCredential(user, credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "could not store credential data",
+		})
+		fmt.Println(err)
+		return
+	}
+	user.Credentials = append(user.Credentials, *credential)
+
+	controller.respondCeremonyResult(c, user, credential)
+}
+
+// authenticatedUser returns the user of the access key sent in the Authorization header. If the access
+// key is invalid it responds with 401 and returns nil.
+func (controller *AuthenticationController) authenticatedUser(c *gin.Context) *User {
+	accessKey, err := controller.accessKeyRepo.FindByValue(accessKeyFromHeader(c.GetHeader("Authorization")))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": err.Error(),
+		})
+		return nil
+	}
+
+	user, err := controller.userRepo.FindByHandle(accessKey.UserHandle)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": ErrInvalidAccessKey.Error(),
+		})
+		fmt.Println(err)
+		return nil
+	}
+	return user
+}
+
+// respondCeremonyResult issues an access key for the user and sends it with the used credential.
+func (controller *AuthenticationController) respondCeremonyResult(c *gin.Context, user *User, credential *Credential) {
+	accessKey, err := NewAccessKey(user)
+	if err == nil {
+		err = controller.accessKeyRepo.Create(accessKey)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "could not create access key",
 		})
+		fmt.Println(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, &CeremonyResultResponse{
+		AccessKey: accessKey.Value,
+		Credential: &CredentialResponse{
+			Id:              credential.Id,
+			AttestationType: credential.AttestationType,
+			BackupEligible:  credential.BackupEligible != nil && *credential.BackupEligible,
+			BackupState:     credential.BackupState,
+			CloneWarning:    credential.CloneWarning,
+		},
+		BackupRecommended: !user.HasBackedUpCredential(),
+	})
 }
 
 func (controller *AuthenticationController) Routes(rg *gin.RouterGroup) {
 	rg.POST("", controller.Authenticate)
 	rg.POST("/register", controller.Register)
 	rg.POST("/login", controller.Login)
+	rg.POST("/conditional", controller.BeginConditionalLogin)
+	rg.POST("/credentials", controller.BeginAddCredential)
+	rg.POST("/credentials/register", controller.AddCredential)
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter serves the authentication routes of a test relying party.
+func newTestRouter(t *testing.T) (*gin.Engine, *WebAuthn) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	webauthn := newTestWebAuthn(t, nil)
+	controller := &AuthenticationController{}
+	controller.Init(webauthn.userRepo, NewInMemoryAccessKeyRepository(), webauthn)
+
+	router := gin.New()
+	controller.Routes(router.Group("authenticate"))
+	return router, webauthn
+}
+
+// postTestRequest sends the body as JSON, authorized with the access key if it is not empty.
+func postTestRequest(t *testing.T, router *gin.Engine, path string, accessKey string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/json")
+	if accessKey != "" {
+		request.Header.Set("Authorization", "Bearer "+accessKey)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// decodeTestResponse expects the status and decodes the response body.
+func decodeTestResponse(t *testing.T, recorder *httptest.ResponseRecorder, status int, response interface{}) {
+	t.Helper()
+
+	if recorder.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, recorder.Code, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// registerTestUserRequest registers the user with the authenticator and returns the issued access key.
+func registerTestUserRequest(t *testing.T, router *gin.Engine, identifier string, authenticator *testAuthenticator) string {
+	t.Helper()
+
+	var options RegisterResponse
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate", "", AuthenticateRequest{Identifier: identifier}), http.StatusOK, &options)
+
+	var result CeremonyResultResponse
+	body := authenticator.registrationBody(options.Challenge, FlagUserPresent, noneAttestation)
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate/register", "", body), http.StatusOK, &result)
+	return result.AccessKey
+}
+
+// addTestCredentialRequest runs the ceremony adding the credential of the authenticator with the access key.
+func addTestCredentialRequest(t *testing.T, router *gin.Engine, accessKey string, authenticator *testAuthenticator) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var options RegisterResponse
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate/credentials", accessKey, nil), http.StatusOK, &options)
+
+	body := authenticator.registrationBody(options.Challenge, FlagUserPresent, noneAttestation)
+	return postTestRequest(t, router, "/authenticate/credentials/register", accessKey, body)
+}
+
+func TestAddCredentialRequest(t *testing.T) {
+	router, webauthn := newTestRouter(t)
+	accessKey := registerTestUserRequest(t, router, "alice", newTestAuthenticator(t))
+
+	authenticator := newTestAuthenticator(t)
+	var result CeremonyResultResponse
+	decodeTestResponse(t, addTestCredentialRequest(t, router, accessKey, authenticator), http.StatusOK, &result)
+	if result.AccessKey == "" || result.AccessKey == accessKey {
+		t.Fatal("expected a new access key")
+	}
+
+	user, err := webauthn.userRepo.FindByCredentialId(authenticator.credentialId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Identifier != "alice" || len(user.Credentials) != 2 {
+		t.Fatalf("expected alice to own 2 credentials, got '%s' with %d", user.Identifier, len(user.Credentials))
+	}
+}
+
+func TestAddCredentialRequestWithoutValidAccessKey(t *testing.T) {
+	router, _ := newTestRouter(t)
+	registerTestUserRequest(t, router, "alice", newTestAuthenticator(t))
+
+	for _, accessKey := range []string{"", "unknown"} {
+		recorder := postTestRequest(t, router, "/authenticate/credentials", accessKey, nil)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401 for access key '%s', got %d", accessKey, recorder.Code)
+		}
+
+		recorder = postTestRequest(t, router, "/authenticate/credentials/register", accessKey, nil)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status 401 for access key '%s', got %d", accessKey, recorder.Code)
+		}
+	}
+}
+
+func TestAddCredentialRequestAlreadyRegistered(t *testing.T) {
+	router, _ := newTestRouter(t)
+	aliceAuthenticator := newTestAuthenticator(t)
+	aliceAccessKey := registerTestUserRequest(t, router, "alice", aliceAuthenticator)
+	bobAccessKey := registerTestUserRequest(t, router, "bob", newTestAuthenticator(t))
+
+	for _, accessKey := range []string{aliceAccessKey, bobAccessKey} {
+		var response map[string]string
+		decodeTestResponse(t, addTestCredentialRequest(t, router, accessKey, aliceAuthenticator), http.StatusConflict, &response)
+		if response["message"] != ErrCredentialAlreadyRegistered.Error() {
+			t.Fatalf("expected message '%s', got '%s'", ErrCredentialAlreadyRegistered, response["message"])
+		}
+	}
+}
+
+func TestRegisterRequestAlreadyRegistered(t *testing.T) {
+	router, _ := newTestRouter(t)
+	authenticator := newTestAuthenticator(t)
+	registerTestUserRequest(t, router, "alice", authenticator)
+
+	var options RegisterResponse
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate", "", AuthenticateRequest{Identifier: "bob"}), http.StatusOK, &options)
+
+	var response map[string]string
+	body := authenticator.registrationBody(options.Challenge, FlagUserPresent, noneAttestation)
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate/register", "", body), http.StatusConflict, &response)
+	if response["message"] != ErrCredentialAlreadyRegistered.Error() {
+		t.Fatalf("expected message '%s', got '%s'", ErrCredentialAlreadyRegistered, response["message"])
+	}
+}
+
+// newTestSqliteRouter serves the authentication routes of a server instance storing everything in the database.
+func newTestSqliteRouter(t *testing.T, db *sql.DB) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	webauthn := newTestWebAuthn(t, nil)
+	webauthn.userRepo = &SqliteUserRepository{db: db}
+	webauthn.challengeRepo = NewSqliteChallengeRepository(db, DefaultMaxOutstandingChallenges)
+	controller := &AuthenticationController{}
+	controller.Init(webauthn.userRepo, NewSqliteAccessKeyRepository(db), webauthn)
+
+	router := gin.New()
+	controller.Routes(router.Group("authenticate"))
+	return router
+}
+
+func TestAddCredentialRequestOnOtherInstance(t *testing.T) {
+	db := newTestDB(t)
+	err := migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessKey := registerTestUserRequest(t, newTestSqliteRouter(t, db), "alice", newTestAuthenticator(t))
+
+	var result CeremonyResultResponse
+	recorder := addTestCredentialRequest(t, newTestSqliteRouter(t, db), accessKey, newTestAuthenticator(t))
+	decodeTestResponse(t, recorder, http.StatusOK, &result)
+}
+
+func TestRequestsWithoutIdentifierDoNotBlockRegistration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.Challenge.MaxOutstanding = 5
+		config.Challenge.MaxOutstandingUsernameless = 5
+	})
+	controller := &AuthenticationController{}
+	controller.Init(webauthn.userRepo, NewInMemoryAccessKeyRepository(), webauthn)
+	router := gin.New()
+	controller.Routes(router.Group("authenticate"))
+
+	for i := 0; i < 10; i++ {
+		postTestRequest(t, router, "/authenticate", "", AuthenticateRequest{})
+		postTestRequest(t, router, "/authenticate/conditional", "", nil)
+	}
+	recorder := postTestRequest(t, router, "/authenticate", "", AuthenticateRequest{})
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 once the usernameless limit is reached, got %d", recorder.Code)
+	}
+
+	registerTestUserRequest(t, router, "alice", newTestAuthenticator(t))
+}
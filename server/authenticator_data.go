@@ -16,9 +16,13 @@ const (
 	// FlagUserVerified Bit 00000100 in the byte sequence. Tells us if user is verified
 	// by the authenticator using a biometric or PIN
 	FlagUserVerified // Referred to as UV
-	_                // Reserved
-	_                // Reserved
-	_                // Reserved
+	// FlagBackupEligible Bit 00001000 in the byte sequence. Indicates whether the credential
+	// source may be backed up, e.g. because it is a synced passkey.
+	FlagBackupEligible // Referred to as BE
+	// FlagBackupState Bit 00010000 in the byte sequence. Indicates whether the credential
+	// source is currently backed up.
+	FlagBackupState // Referred to as BS
+	_               // Reserved
 	// FlagAttestedCredentialData Bit 01000000 in the byte sequence. Indicates whether
 	// the authenticator added attested credential data.
 	FlagAttestedCredentialData // Referred to as AT
@@ -26,6 +30,21 @@ const (
 	FlagHasExtensions //  Referred to as ED
 )
 
+var (
+	// ErrRPIDHashMismatch the RP ID hash in the authenticator data is not the hash of the expected RP ID
+	ErrRPIDHashMismatch = errors.New("RP ID hash mismatch")
+	// ErrUserNotPresent the UP flag is not set
+	ErrUserNotPresent = errors.New("User presence flag not set by authenticator")
+	// ErrUserNotVerified the UV flag is not set, but user verification is required
+	ErrUserNotVerified = errors.New("User verification required but flag not set by authenticator")
+	// ErrMissingAttestedCredentialData the AT flag is not set during registration
+	ErrMissingAttestedCredentialData = errors.New("Attested credential data flag not set by authenticator")
+	// ErrInvalidBackupFlags the BS flag is set without the BE flag
+	ErrInvalidBackupFlags = errors.New("Backup state flag set by authenticator, but credential is not backup eligible")
+	// ErrBackupEligibilityChanged the BE flag differs from the one stored at registration
+	ErrBackupEligibilityChanged = errors.New("Backup eligibility of the credential changed since registration")
+)
+
 // AuthenticatorFlags A byte of information returned during during ceremonies in the
 // authenticatorData that contains bits that give us information about the
 // whether the user was present and/or verified during authentication, and whether
@@ -42,6 +61,16 @@ func (flag AuthenticatorFlags) UserVerified() bool {
 	return (flag & FlagUserVerified) == FlagUserVerified
 }
 
+// BackupEligible returns if the BE flag was set
+func (flag AuthenticatorFlags) BackupEligible() bool {
+	return (flag & FlagBackupEligible) == FlagBackupEligible
+}
+
+// BackupState returns if the BS flag was set
+func (flag AuthenticatorFlags) BackupState() bool {
+	return (flag & FlagBackupState) == FlagBackupState
+}
+
 // HasAttestedCredentialData returns if the AT flag was set
 func (flag AuthenticatorFlags) HasAttestedCredentialData() bool {
 	return (flag & FlagAttestedCredentialData) == FlagAttestedCredentialData
@@ -169,33 +198,49 @@ func (a *AuthenticatorData) Verify(rpIdHash, appIDHash []byte, userVerificationR
 	// Verify that the RP ID hash in authData is indeed the SHA-256
 	// hash of the RP ID expected by the RP.
 	if !bytes.Equal(a.RPIDHash[:], rpIdHash) && !bytes.Equal(a.RPIDHash[:], appIDHash) {
-		return errors.New(fmt.Sprintf("RP Hash mismatch. Expected %x and Received %x\n", a.RPIDHash, rpIdHash))
+		return fmt.Errorf("%w: expected %x and received %x", ErrRPIDHashMismatch, rpIdHash, a.RPIDHash)
 	}
 
 	// Registration Step 10 & Assertion Step 12
 	// Verify that the User Present bit of the flags in authData is set.
 	if !a.Flags.UserPresent() {
-		return errors.New(fmt.Sprintln("User presence flag not set by authenticator"))
+		return ErrUserNotPresent
 	}
 
 	// Registration Step 11 & Assertion Step 13
 	// If user verification is required for this assertion, verify that
 	// the User Verified bit of the flags in authData is set.
 	if userVerificationRequired && !a.Flags.UserVerified() {
-		return errors.New(fmt.Sprintln("User verification required but flag not set by authenticator"))
+		return ErrUserNotVerified
 	}
 
-	// Registration Step 12 & Assertion Step 14
-	// Verify that the values of the client extension outputs in clientExtensionResults
-	// and the authenticator extension outputs in the extensions in authData are as
-	// expected, considering the client extension input values that were given as the
-	// extensions option in the create() call. In particular, any extension identifier
-	// values in the clientExtensionResults and the extensions in authData MUST be also be
-	// present as extension identifier values in the extensions member of options, i.e., no
-	// extensions are present that were not requested. In the general case, the meaning
-	// of "are as expected" is specific to the RelyingParty Party and which extensions are in use.
+	// A credential can only be backed up if it is backup eligible
+	// See https://w3c.github.io/webauthn/#sctn-credential-backup
+	if a.Flags.BackupState() && !a.Flags.BackupEligible() {
+		return ErrInvalidBackupFlags
+	}
 
-	// This is not yet fully implemented by the spec or by browsers
+	// Registration Step 12 & Assertion Step 14 compare the extension outputs with the requested
+	// extensions, which are only known to the session; see SessionData.VerifyExtensions
 
 	return nil
 }
+
+// ExtensionIdentifiers returns the identifiers of the authenticator extension outputs in the extensions of authData.
+func (a *AuthenticatorData) ExtensionIdentifiers() ([]string, error) {
+	if len(a.ExtData) == 0 {
+		return nil, nil
+	}
+
+	var extensions map[string]cbor.RawMessage
+	err := cbor.Unmarshal(a.ExtData, &extensions)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode authenticator extensions: %w", err)
+	}
+
+	identifiers := []string{}
+	for identifier := range extensions {
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers, nil
+}
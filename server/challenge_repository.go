@@ -1,71 +1,275 @@
 package main
 
 import (
+	"crypto/rand"
 	"errors"
-    "fmt"
-    "math/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
 )
 
-const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+// MinChallengeLength is the minimum number of random bytes in a challenge.
+// See https://w3c.github.io/webauthn/#sctn-cryptographic-challenges
+const MinChallengeLength = 16
 
-func randStringBytes(n int) string {
-    b := make([]byte, n)
-    for i := range b {
-        b[i] = letterBytes[rand.Intn(len(letterBytes))]
-    }
-    return string(b)
+// DefaultChallengeLength is used if no challenge length is configured
+const DefaultChallengeLength = 32
+
+// DefaultChallengeTimeout is used if no challenge timeout is configured, in milliseconds
+const DefaultChallengeTimeout = 60000
+
+// DefaultConditionalChallengeTimeout is used if no timeout for conditional mediation is configured, in milliseconds
+const DefaultConditionalChallengeTimeout = 300000
+
+// DefaultMaxOutstandingChallenges is used if no limit for outstanding challenges is configured
+const DefaultMaxOutstandingChallenges = 10000
+
+// DefaultMaxOutstandingUsernamelessChallenges is used if no limit for outstanding challenges of logins
+// without an identifier is configured
+const DefaultMaxOutstandingUsernamelessChallenges = 1000
+
+type ChallengeConfig struct {
+	// Number of random bytes in a challenge; defaults to DefaultChallengeLength
+	Length int `json:"length"`
+	// Milliseconds until a challenge expires, also sent to the client as the ceremony timeout
+	Timeout int32 `json:"timeout"`
+	// Milliseconds until a challenge for conditional mediation expires; the browser may offer the
+	// credentials for as long as the sign-in page is open
+	ConditionalTimeout int32 `json:"conditionalTimeout"`
+	// Maximum number of challenges that are issued but not yet used or expired
+	MaxOutstanding int `json:"maxOutstanding"`
+	// Maximum number of outstanding challenges for logins without an identifier, including conditional
+	// mediation; anyone can request them, so they are limited separately and can not exhaust MaxOutstanding
+	MaxOutstandingUsernameless int `json:"maxOutstandingUsernameless"`
+	// Where challenges and access keys are stored; defaults to "memory"
+	Store ChallengeStore `json:"store"`
+}
+
+func (config *ChallengeConfig) validate() error {
+	if config.Length == 0 {
+		config.Length = DefaultChallengeLength
+	}
+
+	if config.Length < MinChallengeLength {
+		return fmt.Errorf("Challenge length must be at least %d bytes, got %d", MinChallengeLength, config.Length)
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultChallengeTimeout
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("Challenge timeout must be positive, got %d", config.Timeout)
+	}
+
+	if config.ConditionalTimeout == 0 {
+		config.ConditionalTimeout = DefaultConditionalChallengeTimeout
+	}
+	if config.ConditionalTimeout < 0 {
+		return fmt.Errorf("Conditional challenge timeout must be positive, got %d", config.ConditionalTimeout)
+	}
+
+	if config.MaxOutstanding == 0 {
+		config.MaxOutstanding = DefaultMaxOutstandingChallenges
+	}
+	if config.MaxOutstanding < 0 {
+		return fmt.Errorf("Maximum number of outstanding challenges must be positive, got %d", config.MaxOutstanding)
+	}
+
+	if config.MaxOutstandingUsernameless == 0 {
+		config.MaxOutstandingUsernameless = DefaultMaxOutstandingUsernamelessChallenges
+	}
+	if config.MaxOutstandingUsernameless < 0 {
+		return fmt.Errorf("Maximum number of outstanding usernameless challenges must be positive, got %d", config.MaxOutstandingUsernameless)
+	}
+
+	switch config.Store {
+	case "":
+		config.Store = ChallengeStoreMemory
+	case ChallengeStoreMemory, ChallengeStoreSqlite:
+	default:
+		return fmt.Errorf("Unknown challenge store '%s'", config.Store)
+	}
+	return nil
+}
+
+// TTL returns the duration after which a challenge expires
+func (config *ChallengeConfig) TTL() time.Duration {
+	return time.Duration(config.Timeout) * time.Millisecond
 }
 
-func GenerateChallenge() string {
-    return randStringBytes(32)
+// ChallengeStore selects where outstanding challenges are kept
+type ChallengeStore string
+
+const (
+	// ChallengeStoreMemory keeps challenges and access keys in the memory of the server process
+	ChallengeStoreMemory ChallengeStore = "memory"
+	// ChallengeStoreSqlite keeps challenges and access keys in the database, shared by all server instances
+	ChallengeStoreSqlite ChallengeStore = "sqlite"
+)
+
+// ChallengeGenerator creates the random challenges sent to the client in a ceremony.
+type ChallengeGenerator struct {
+	length int
+	source io.Reader
+}
+
+// NewChallengeGenerator creates a generator reading challenges of the given length from
+// crypto/rand.
+func NewChallengeGenerator(length int) *ChallengeGenerator {
+	return &ChallengeGenerator{
+		length: length,
+		source: rand.Reader,
+	}
+}
+
+// Generate returns a new challenge
+func (generator *ChallengeGenerator) Generate() ([]byte, error) {
+	challenge := make([]byte, generator.length)
+	_, err := io.ReadFull(generator.source, challenge)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
 }
 
+// ErrChallengeExpired the challenge was issued longer ago than its time to live
+var ErrChallengeExpired = errors.New("Challenge expired")
+
+// ErrTooManyChallenges the maximum number of outstanding challenges is reached
+var ErrTooManyChallenges = errors.New("Too many outstanding challenges")
+
+// ErrChallengeNotFound the challenge was never issued or was already used
+var ErrChallengeNotFound = errors.New("Could not find challenge")
+
 type Challenge struct {
-	Value    string
-	Response interface{}
+	Value   string
+	Session *SessionData
+}
+
+// Expired tells whether the challenge can no longer be used at the given time.
+func (challenge *Challenge) Expired(now time.Time) bool {
+	return challenge.Session.Expired(now)
 }
 
 type ChallengeRepository interface {
 	FindByValue(value string) (*Challenge, error)
 	Create(user *Challenge) error
 	DeleteByValue(value string) error
+	// FindAndDeleteByValue returns the challenge and deletes it in one step, so the challenge
+	// can not be returned to more than one caller
+	FindAndDeleteByValue(value string) (*Challenge, error)
+	// DeleteExpired removes all challenges that expired before the given time
+	DeleteExpired(now time.Time) error
 }
 
 type InMemoryChallengeRepository struct {
-	challenges map[string]interface{}
+	mutex          sync.Mutex
+	challenges     map[string]*Challenge
+	maxOutstanding int
 }
 
-func (repo *InMemoryChallengeRepository) FindByValue(value string) (*Challenge, error) {
-	authenticateResponse, ok := repo.challenges[value]
-	if !ok {
-		return nil, fmt.Errorf("Could not find challenge '%s'", value)
+// NewInMemoryChallengeRepository creates a repository holding at most maxOutstanding challenges.
+func NewInMemoryChallengeRepository(maxOutstanding int) *InMemoryChallengeRepository {
+	return &InMemoryChallengeRepository{
+		challenges:     map[string]*Challenge{},
+		maxOutstanding: maxOutstanding,
 	}
+}
+
+func (repo *InMemoryChallengeRepository) FindByValue(value string) (*Challenge, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 
-	r, ok := authenticateResponse.(RegisterResponse)
-	if ok {
-		return &Challenge{
-			Value:    r.Challenge,
-			Response: authenticateResponse,
-		}, nil
+	challenge, ok := repo.challenges[value]
+	if !ok {
+		return nil, ErrChallengeNotFound
 	}
 
-	l, ok := authenticateResponse.(LoginResponse)
-	if ok {
-		return &Challenge{
-			Value:    l.Challenge,
-			Response: authenticateResponse,
-		}, nil
+	if challenge.Expired(time.Now()) {
+		delete(repo.challenges, value)
+		return nil, ErrChallengeExpired
 	}
 
-	return nil, errors.New("Not found")
+	return challenge, nil
 }
 
 func (repo *InMemoryChallengeRepository) Create(challenge *Challenge) error {
-	repo.challenges[challenge.Value] = challenge.Response
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if len(repo.challenges) >= repo.maxOutstanding {
+		repo.deleteExpired(time.Now())
+	}
+	if len(repo.challenges) >= repo.maxOutstanding {
+		return ErrTooManyChallenges
+	}
+
+	repo.challenges[challenge.Value] = challenge
 	return nil
 }
 
 func (repo *InMemoryChallengeRepository) DeleteByValue(value string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	delete(repo.challenges, value)
+	return nil
+}
+
+func (repo *InMemoryChallengeRepository) FindAndDeleteByValue(value string) (*Challenge, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	challenge, ok := repo.challenges[value]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
 	delete(repo.challenges, value)
+
+	if challenge.Expired(time.Now()) {
+		return nil, ErrChallengeExpired
+	}
+
+	return challenge, nil
+}
+
+func (repo *InMemoryChallengeRepository) DeleteExpired(now time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.deleteExpired(now)
 	return nil
 }
+
+func (repo *InMemoryChallengeRepository) deleteExpired(now time.Time) {
+	for value, challenge := range repo.challenges {
+		if challenge.Expired(now) {
+			delete(repo.challenges, value)
+		}
+	}
+}
+
+// SweepChallenges deletes expired challenges from the repository in the given interval until the
+// returned stop function is called.
+func SweepChallenges(repo ChallengeRepository, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				err := repo.DeleteExpired(now)
+				if err != nil {
+					fmt.Println(err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
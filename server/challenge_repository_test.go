@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChallengeCanOnlyBeConsumedOnce(t *testing.T) {
+	repo := NewInMemoryChallengeRepository(10)
+	err := repo.Create(newTestChallenge("challenge", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var consumed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.FindAndDeleteByValue("challenge")
+			if err == nil {
+				atomic.AddInt32(&consumed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if consumed != 1 {
+		t.Fatalf("expected challenge to be consumed once, got %d", consumed)
+	}
+}
+
+func TestChallengeRepositoryConcurrentAccess(t *testing.T) {
+	repo := NewInMemoryChallengeRepository(1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := fmt.Sprintf("challenge-%d", i)
+			err := repo.Create(newTestChallenge(value, time.Now()))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_, err = repo.FindByValue(value)
+			if err != nil {
+				t.Error(err)
+			}
+			repo.DeleteExpired(time.Now())
+			_, err = repo.FindAndDeleteByValue(value)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(repo.challenges) != 0 {
+		t.Fatalf("expected all challenges to be consumed, %d left", len(repo.challenges))
+	}
+}
+
+func TestExpiredChallengeIsRejected(t *testing.T) {
+	repo := NewInMemoryChallengeRepository(10)
+	repo.Create(newTestChallenge("challenge", time.Now().Add(-2*time.Minute)))
+
+	_, err := repo.FindAndDeleteByValue("challenge")
+	if err != ErrChallengeExpired {
+		t.Fatalf("expected ErrChallengeExpired, got %v", err)
+	}
+}
+
+func TestOutstandingChallengesAreBounded(t *testing.T) {
+	repo := NewInMemoryChallengeRepository(1)
+	repo.Create(newTestChallenge("first", time.Now()))
+
+	err := repo.Create(newTestChallenge("second", time.Now()))
+	if err != ErrTooManyChallenges {
+		t.Fatalf("expected ErrTooManyChallenges, got %v", err)
+	}
+}
+
+func newTestChallenge(value string, issuedAt time.Time) *Challenge {
+	return &Challenge{
+		Value: value,
+		Session: &SessionData{
+			Kind:      CeremonyAuthentication,
+			Challenge: []byte(value),
+			IssuedAt:  issuedAt,
+			Expires:   issuedAt.Add(time.Minute),
+		},
+	}
+}
+
+func TestChallengeGeneratorReadsFromSource(t *testing.T) {
+	source := make([]byte, 2*MinChallengeLength)
+	for i := range source {
+		source[i] = byte(i)
+	}
+	generator := NewChallengeGenerator(MinChallengeLength)
+	generator.source = bytes.NewReader(source)
+
+	for i := 0; i < 2; i++ {
+		challenge, err := generator.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(challenge, source[i*MinChallengeLength:(i+1)*MinChallengeLength]) {
+			t.Fatalf("expected challenge %x, got %x", source[i*MinChallengeLength:(i+1)*MinChallengeLength], challenge)
+		}
+	}
+
+	_, err := generator.Generate()
+	if err == nil {
+		t.Fatal("expected an exhausted source to fail")
+	}
+}
+
+func TestCeremonyUsesChallengeSource(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	source := bytes.Repeat([]byte{0x42}, DefaultChallengeLength)
+	webauthn.UseChallengeSource(bytes.NewReader(source))
+
+	options, err := webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := options.(LoginResponse).Challenge
+	if len(challenge) != DefaultChallengeLength || !bytes.Equal(challenge, source) {
+		t.Fatalf("expected challenge %x, got %x", source, challenge)
+	}
+
+	_, err = webauthn.usernamelessRepo.FindByValue(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChallengeConfigLength(t *testing.T) {
+	config := ChallengeConfig{}
+	err := config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Length != DefaultChallengeLength {
+		t.Fatalf("expected default length %d, got %d", DefaultChallengeLength, config.Length)
+	}
+
+	config = ChallengeConfig{Length: MinChallengeLength}
+	err = config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config = ChallengeConfig{Length: MinChallengeLength - 1}
+	err = config.validate()
+	if err == nil {
+		t.Fatal("expected challenges shorter than the minimum length to be rejected")
+	}
+}
+
+func TestChallengeConfigMaxOutstandingUsernameless(t *testing.T) {
+	config := ChallengeConfig{}
+	err := config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxOutstandingUsernameless != DefaultMaxOutstandingUsernamelessChallenges {
+		t.Fatalf("expected default limit %d, got %d", DefaultMaxOutstandingUsernamelessChallenges, config.MaxOutstandingUsernameless)
+	}
+
+	config = ChallengeConfig{MaxOutstandingUsernameless: -1}
+	err = config.validate()
+	if err == nil {
+		t.Fatal("expected a negative limit to be rejected")
+	}
+}
+
+func TestUsernamelessChallengesDoNotExhaustOtherCeremonies(t *testing.T) {
+	for name, begin := range map[string]func(webauthn *WebAuthn) (interface{}, error){
+		"discoverable": (*WebAuthn).BeginDiscoverableLogin,
+		"conditional":  (*WebAuthn).BeginConditionalLogin,
+	} {
+		t.Run(name, func(t *testing.T) {
+			webauthn := newTestWebAuthn(t, func(config *Config) {
+				config.Challenge.MaxOutstanding = 2
+				config.Challenge.MaxOutstandingUsernameless = 2
+			})
+
+			for i := 0; i < 2; i++ {
+				_, err := begin(webauthn)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := webauthn.BeginDiscoverableLogin()
+			if err != ErrTooManyChallenges {
+				t.Fatalf("expected ErrTooManyChallenges for a discoverable login, got %v", err)
+			}
+			_, err = webauthn.BeginConditionalLogin()
+			if err != ErrTooManyChallenges {
+				t.Fatalf("expected ErrTooManyChallenges for a conditional login, got %v", err)
+			}
+
+			_, err = webauthn.BeginRegister(&User{Identifier: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = webauthn.BeginLogin(&User{Handle: []byte("bob"), Identifier: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConditionalLogin(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	options, err := webauthn.BeginConditionalLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := authenticator.login(options.(LoginResponse).Challenge, FlagUserPresent, user.Handle)
+
+	_, err = webauthn.ConsumeSession(request.Response.ClientData, CeremonyRegistration)
+	if err == nil {
+		t.Fatal("expected conditional challenge not to be usable for registration")
+	}
+
+	session, err := webauthn.ConsumeSession(request.Response.ClientData, CeremonyAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = webauthn.FinishLogin(request, session, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = webauthn.ConsumeSession(request.Response.ClientData, CeremonyAuthentication)
+	if err != ErrChallengeNotFound {
+		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
+	}
+}
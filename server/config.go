@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 )
 
 type CorsConfig struct {
@@ -11,19 +14,154 @@ type CorsConfig struct {
 	Headers []string `json:"header"`
 }
 
+type AttestationConfig struct {
+	// The attestation conveyance preference sent during registration; defaults to "none"
+	Conveyance AttestationConveyancePreference `json:"conveyance"`
+	// Whether registrations with the none attestation statement format are rejected
+	RequireAttestation bool `json:"requireAttestation"`
+	// PEM files containing the trusted root certificates per attestation statement format
+	RootCertificates map[string]string `json:"rootCertificates"`
+}
+
+type MetadataConfig struct {
+	// Path to a FIDO Metadata Service BLOB; metadata is not used if empty
+	BLOBPath string `json:"blobPath"`
+	// PEM file containing the root certificate the BLOB has to be signed with
+	RootCertificate string `json:"rootCertificate"`
+}
+
 type Config struct {
 	RelyingParty              RelyingParty                    `json:"relyingParty"`
 	PublicKeyCredentialParams []*PublicKeyCredentialParameter `json:"publicKeyCredentialParams"`
+	Challenge                 ChallengeConfig                 `json:"challenge"`
 	Authenticator             string                          `json:"authenticator"`
+	ResidentKey               ResidentKeyRequirement          `json:"residentKey"`
+	UserVerification          UserVerificationConfig          `json:"userVerification"`
+	Extensions                ExtensionsConfig                `json:"extensions"`
+	Attestation               AttestationConfig               `json:"attestation"`
+	Metadata                  MetadataConfig                  `json:"metadata"`
+	RegistrationPolicy        RegistrationPolicyConfig        `json:"registrationPolicy"`
+	SignCountPolicy           SignCountPolicy                 `json:"signCountPolicy"`
+	Origins                   OriginConfig                    `json:"origins"`
 	Cors                      CorsConfig                      `json:"cors"`
 	Port                      int                             `json:"port"`
 }
 
 func ReadConfig() (*Config, error) {
-	configBytes, _ := os.ReadFile("./config.json")
+	configBytes, err := os.ReadFile("./config.json")
+	if err != nil {
+		return nil, err
+	}
 
 	config := &Config{}
-	json.Unmarshal(configBytes, config)
+	err = json.Unmarshal(configBytes, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.RelyingParty.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Challenge.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.ResidentKey.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.UserVerification.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Origins.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, origin := range config.Origins.Allowed {
+		err = config.RelyingParty.VerifyOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = config.Attestation.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.RegistrationPolicy.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.SignCountPolicy.validate()
+	if err != nil {
+		return nil, err
+	}
+
 	fmt.Println(config)
 	return config, nil
 }
+
+func (config *AttestationConfig) validate() error {
+	switch config.Conveyance {
+	case "":
+		config.Conveyance = AttestationConveyanceNone
+	case AttestationConveyanceNone, AttestationConveyanceIndirect, AttestationConveyanceDirect, AttestationConveyanceEnterprise:
+	default:
+		return fmt.Errorf("Unknown attestation conveyance preference '%s'", config.Conveyance)
+	}
+
+	if config.RequireAttestation && config.Conveyance == AttestationConveyanceNone {
+		return fmt.Errorf("Attestation is required, but the conveyance preference is '%s'", config.Conveyance)
+	}
+	return nil
+}
+
+// RootCertificatePool loads the root certificates configured for the given attestation statement format.
+// It returns nil if no roots are configured for the format.
+func (config *AttestationConfig) RootCertificatePool(format string) (*x509.CertPool, error) {
+	path, ok := config.RootCertificates[format]
+	if !ok {
+		return nil, nil
+	}
+	return loadCertificatePool(path)
+}
+
+// LoadService loads the configured metadata BLOB. It returns nil if no BLOB is configured.
+func (config *MetadataConfig) LoadService() (*BLOBMetadataService, error) {
+	if config.BLOBPath == "" {
+		return nil, nil
+	}
+
+	if config.RootCertificate == "" {
+		return nil, errors.New("Metadata BLOB is configured without a root certificate")
+	}
+
+	roots, err := loadCertificatePool(config.RootCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadMetadataBLOB(config.BLOBPath, roots, time.Now())
+}
+
+func loadCertificatePool(path string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("No certificates found in '%s'", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,11 @@
+package main
+
+// ExtensionsConfig sets the client extension inputs sent with the options per ceremony, by extension identifier.
+// Extension outputs of the client or authenticator are only accepted for requested extensions.
+// See https://w3c.github.io/webauthn/#sctn-extensions
+type ExtensionsConfig struct {
+	// Sent when registering new and additional credentials, e.g. {"credProps": true}
+	Registration map[string]interface{} `json:"registration"`
+	// Sent when logging in
+	Authentication map[string]interface{} `json:"authentication"`
+}
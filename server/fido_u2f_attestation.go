@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+type FIDOU2FAttestationStatement struct {
+	Signature    []byte   `cbor:"sig"`
+	Certificates [][]byte `cbor:"x5c"`
+}
+
+// FIDOU2FAttestationVerifier implements the verification procedure of the fido-u2f attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-fido-u2f-attestation
+type FIDOU2FAttestationVerifier struct{}
+
+func (verifier *FIDOU2FAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt FIDOU2FAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that x5c has exactly one element and let attCert be that element.
+	if len(attStmt.Certificates) != 1 {
+		return nil, fmt.Errorf("FIDO U2F attestation requires exactly one certificate; got %d", len(attStmt.Certificates))
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	attestationCertificate := certificates[0]
+
+	// Let certificate public key be the public key conveyed by attCert. If certificate public key
+	// is not an Elliptic Curve (EC) public key over the P-256 curve, terminate this algorithm.
+	certificateKey, ok := attestationCertificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok || certificateKey.Curve != elliptic.P256() {
+		return nil, errors.New("FIDO U2F attestation certificate must contain a P-256 public key")
+	}
+
+	publicKey, err := attestationObject.CredentialPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyU2F, err := u2fPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := attestationObject.AuthnData
+	verificationData := []byte{0x00}
+	verificationData = append(verificationData, authData.RPIDHash...)
+	verificationData = append(verificationData, clientDataHash...)
+	verificationData = append(verificationData, authData.AttData.CredentialID...)
+	verificationData = append(verificationData, publicKeyU2F...)
+
+	err = attestationCertificate.CheckSignature(x509.ECDSAWithSHA256, verificationData, attStmt.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("Attestation signature is invalid: %w", err)
+	}
+
+	return &AttestationResult{
+		Type:      AttestationTypeBasic,
+		TrustPath: certificates,
+	}, nil
+}
+
+// u2fPublicKey converts the COSE credential public key to the raw ANSI X9.62 public key format
+// (0x04 || x || y) used by U2F authenticators.
+func u2fPublicKey(publicKey PublicKey) ([]byte, error) {
+	ec2, ok := publicKey.(*EC2PublicKeyData)
+	if !ok {
+		return nil, errors.New("FIDO U2F credential public key must be an EC2 key")
+	}
+
+	if len(ec2.XCoord) != 32 || len(ec2.YCoord) != 32 {
+		return nil, errors.New("FIDO U2F credential public key coordinates must be 32 bytes long")
+	}
+
+	rawKey := []byte{0x04}
+	rawKey = append(rawKey, ec2.XCoord...)
+	rawKey = append(rawKey, ec2.YCoord...)
+	return rawKey, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+// fidoU2FAttestation creates fido-u2f attestation statements of the authenticator, signed with the key of
+// the first certificate.
+func fidoU2FAttestation(t *testing.T, authenticator *testAuthenticator, key *ecdsa.PrivateKey, certificates ...*x509.Certificate) attestationStatementFunc {
+	return func(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+		publicKey := authenticator.key.PublicKey
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+
+		verificationData := []byte{0x00}
+		verificationData = append(verificationData, authData[:32]...)
+		verificationData = append(verificationData, clientDataHash...)
+		verificationData = append(verificationData, authenticator.credentialId...)
+		verificationData = append(verificationData, 0x04)
+		verificationData = append(verificationData, publicKey.X.FillBytes(make([]byte, size))...)
+		verificationData = append(verificationData, publicKey.Y.FillBytes(make([]byte, size))...)
+
+		digest := sha256.Sum256(verificationData)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x5c := [][]byte{}
+		for _, certificate := range certificates {
+			x5c = append(x5c, certificate.Raw)
+		}
+		return "fido-u2f", map[string]interface{}{"sig": signature, "x5c": x5c}
+	}
+}
+
+func TestFIDOU2FAttestation(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	attestationKey := newTestKey(t)
+	certificate := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Authenticator"}, false, attestationKey, nil, nil)
+
+	request := authenticator.register([]byte("challenge"), FlagUserPresent, fidoU2FAttestation(t, authenticator, attestationKey, certificate))
+	response := request.Response
+
+	attestation, err := (&FIDOU2FAttestationVerifier{}).Verify(&response.AttestationObject, response.ClientDataHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Type != AttestationTypeBasic || attestation.Trusted || len(attestation.TrustPath) != 1 {
+		t.Fatalf("expected untrusted basic attestation with one certificate, got %s (trusted: %v)", attestation.Type, attestation.Trusted)
+	}
+}
+
+func TestRegisterWithFIDOU2FAttestationIsTreatedAsSelfAttestation(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	attestationKey := newTestKey(t)
+	certificate := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Authenticator"}, false, attestationKey, nil, nil)
+
+	user := registerTestUser(t, webauthn, authenticator, fidoU2FAttestation(t, authenticator, attestationKey, certificate))
+
+	if user.Credentials[0].AttestationType != AttestationTypeSelf {
+		t.Fatalf("expected self attestation, got %s", user.Credentials[0].AttestationType)
+	}
+}
+
+func TestFIDOU2FAttestationIsRejected(t *testing.T) {
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Authenticator := newTestAuthenticator(t)
+	p384Authenticator.key = p384Key
+
+	for _, test := range []struct {
+		name          string
+		authenticator *testAuthenticator
+		attestation   func(authenticator *testAuthenticator) attestationStatementFunc
+	}{
+		{
+			name:          "attestation certificate not on P-256",
+			authenticator: newTestAuthenticator(t),
+			attestation: func(authenticator *testAuthenticator) attestationStatementFunc {
+				certificate := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Authenticator"}, false, p384Key, nil, nil)
+				return fidoU2FAttestation(t, authenticator, p384Key, certificate)
+			},
+		},
+		{
+			name:          "more than one certificate",
+			authenticator: newTestAuthenticator(t),
+			attestation: func(authenticator *testAuthenticator) attestationStatementFunc {
+				rootKey := newTestKey(t)
+				root := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Root"}, true, rootKey, nil, nil)
+				attestationKey := newTestKey(t)
+				certificate := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Authenticator"}, false, attestationKey, root, rootKey)
+				return fidoU2FAttestation(t, authenticator, attestationKey, certificate, root)
+			},
+		},
+		{
+			name:          "credential public key not on P-256",
+			authenticator: p384Authenticator,
+			attestation: func(authenticator *testAuthenticator) attestationStatementFunc {
+				attestationKey := newTestKey(t)
+				certificate := newTestCertificate(t, pkix.Name{CommonName: "Test U2F Authenticator"}, false, attestationKey, nil, nil)
+				return fidoU2FAttestation(t, authenticator, attestationKey, certificate)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := test.authenticator.register([]byte("challenge"), FlagUserPresent, test.attestation(test.authenticator))
+			response := request.Response
+
+			_, err := (&FIDOU2FAttestationVerifier{}).Verify(&response.AttestationObject, response.ClientDataHash)
+			if err == nil {
+				t.Fatal("expected attestation to be rejected")
+			}
+		})
+	}
+}
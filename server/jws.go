@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// jwsCurves maps the ECDSA algorithms of a JWS to the curve of their key.
+// See https://www.rfc-editor.org/rfc/rfc7518#section-3.4
+var jwsCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// JWSHeader is the protected header of a JSON Web Signature as used by SafetyNet responses and metadata BLOBs.
+type JWSHeader struct {
+	Algorithm    string   `json:"alg"`
+	Type         string   `json:"typ"`
+	Certificates [][]byte `json:"x5c"`
+}
+
+// JWS is a parsed JSON Web Signature in compact serialization.
+// See https://www.rfc-editor.org/rfc/rfc7515
+type JWS struct {
+	Header       JWSHeader
+	Payload      []byte
+	SigningInput []byte
+	Signature    []byte
+}
+
+// ParseJWS splits and decodes a compact serialized JWS. The signature is not verified.
+func ParseJWS(token []byte) (*JWS, error) {
+	parts := strings.Split(strings.TrimSpace(string(token)), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("JWS must consist of three parts")
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode JWS header: %w", err)
+	}
+
+	var header JWSHeader
+	err = json.Unmarshal(rawHeader, &header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse JWS header: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode JWS payload: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode JWS signature: %w", err)
+	}
+
+	return &JWS{
+		Header:       header,
+		Payload:      payload,
+		SigningInput: []byte(parts[0] + "." + parts[1]),
+		Signature:    signature,
+	}, nil
+}
+
+// Verify checks the signature of the JWS with the public key of the given certificate.
+func (jws *JWS) Verify(certificate *x509.Certificate) error {
+	var hash crypto.Hash
+	switch jws.Header.Algorithm {
+	case "RS256", "ES256", "PS256":
+		hash = crypto.SHA256
+	case "RS384", "ES384", "PS384":
+		hash = crypto.SHA384
+	case "RS512", "ES512", "PS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("JWS algorithm '%s' is not supported", jws.Header.Algorithm)
+	}
+
+	h := hash.New()
+	h.Write(jws.SigningInput)
+	digest := h.Sum(nil)
+
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if strings.HasPrefix(jws.Header.Algorithm, "PS") {
+			err = rsa.VerifyPSS(key, hash, digest, jws.Signature, nil)
+		} else if strings.HasPrefix(jws.Header.Algorithm, "RS") {
+			err = rsa.VerifyPKCS1v15(key, hash, digest, jws.Signature)
+		} else {
+			err = errors.New("algorithm does not match RSA key")
+		}
+		if err != nil {
+			return fmt.Errorf("JWS signature is invalid: %w", err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		curve, ok := jwsCurves[jws.Header.Algorithm]
+		if !ok || key.Curve != curve {
+			return fmt.Errorf("JWS algorithm '%s' does not match the ECDSA key", jws.Header.Algorithm)
+		}
+
+		// ECDSA signatures of a JWS are the concatenation of r and s, each padded to the size of the curve
+		half := (curve.Params().BitSize + 7) / 8
+		if len(jws.Signature) != 2*half {
+			return errors.New("JWS signature is invalid")
+		}
+		r := big.NewInt(0).SetBytes(jws.Signature[:half])
+		s := big.NewInt(0).SetBytes(jws.Signature[half:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("JWS signature is invalid")
+		}
+		return nil
+	default:
+		return errors.New("JWS certificate key type is not supported")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// signTestJWS creates a compact serialized JWS of the payload, signed with the key using the given algorithm.
+func signTestJWS(t *testing.T, algorithm string, key crypto.Signer, certificates []*x509.Certificate, payload []byte) []byte {
+	t.Helper()
+
+	x5c := [][]byte{}
+	for _, certificate := range certificates {
+		x5c = append(x5c, certificate.Raw)
+	}
+	header, err := json.Marshal(JWSHeader{Algorithm: algorithm, Type: "JWT", Certificates: x5c})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[algorithm[2:]]
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch {
+	case strings.HasPrefix(algorithm, "RS"):
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, digest)
+	case strings.HasPrefix(algorithm, "PS"):
+		signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case strings.HasPrefix(algorithm, "ES"):
+		ecdsaKey := key.(*ecdsa.PrivateKey)
+		size := (ecdsaKey.Curve.Params().BitSize + 7) / 8
+		r, s, signErr := ecdsa.Sign(rand.Reader, ecdsaKey, digest)
+		signature, err = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...), signErr
+	default:
+		t.Fatalf("unknown algorithm '%s'", algorithm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(signingInput + "." + base64.RawURLEncoding.EncodeToString(signature))
+}
+
+func TestJWSVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKeys := map[elliptic.Curve]*ecdsa.PrivateKey{}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		ecdsaKeys[curve], err = ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		key       crypto.Signer
+		verifyKey crypto.PublicKey
+		wantErr   bool
+	}{
+		{"RS256", "RS256", rsaKey, nil, false},
+		{"RS512", "RS512", rsaKey, nil, false},
+		{"PS256", "PS256", rsaKey, nil, false},
+		{"PS384", "PS384", rsaKey, nil, false},
+		{"ES256", "ES256", ecdsaKeys[elliptic.P256()], nil, false},
+		{"ES384", "ES384", ecdsaKeys[elliptic.P384()], nil, false},
+		{"ES512", "ES512", ecdsaKeys[elliptic.P521()], nil, false},
+		{"ES256 with P-384 key", "ES256", ecdsaKeys[elliptic.P384()], nil, true},
+		{"ES384 with P-256 key", "ES384", ecdsaKeys[elliptic.P256()], nil, true},
+		{"ES512 with P-384 key", "ES512", ecdsaKeys[elliptic.P384()], nil, true},
+		{"RS256 with ECDSA certificate", "RS256", rsaKey, &ecdsaKeys[elliptic.P256()].PublicKey, true},
+		{"ES256 with RSA certificate", "ES256", ecdsaKeys[elliptic.P256()], &rsaKey.PublicKey, true},
+		{"other key", "ES256", ecdsaKeys[elliptic.P256()], &newTestKey(t).PublicKey, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := signTestJWS(t, test.algorithm, test.key, nil, []byte(`{"test":true}`))
+			jws, err := ParseJWS(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verifyKey := test.verifyKey
+			if verifyKey == nil {
+				verifyKey = test.key.Public()
+			}
+			err = jws.Verify(&x509.Certificate{PublicKey: verifyKey})
+			if test.wantErr && err == nil {
+				t.Fatal("expected signature to be rejected")
+			}
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestJWSVerifyTamperedPayload(t *testing.T) {
+	key := newTestKey(t)
+	token := signTestJWS(t, "ES256", key, nil, []byte(`{"test":true}`))
+	parts := strings.Split(string(token), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"test":false}`))
+
+	jws, err := ParseJWS([]byte(strings.Join(parts, ".")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jws.Verify(&x509.Certificate{PublicKey: &key.PublicKey})
+	if err == nil {
+		t.Fatal("expected tampered payload to be rejected")
+	}
+}
+
+func TestJWSVerifyUnsupportedAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"none", "HS256", ""} {
+		jws := &JWS{Header: JWSHeader{Algorithm: algorithm}, SigningInput: []byte("input")}
+		err := jws.Verify(&x509.Certificate{PublicKey: &newTestKey(t).PublicKey})
+		if err == nil {
+			t.Fatalf("expected algorithm '%s' to be rejected", algorithm)
+		}
+	}
+}
+
+func TestParseMalformedJWS(t *testing.T) {
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!.e30.AA", "e30.!.AA", "e30.e30.!", "bm8.e30.AA"} {
+		_, err := ParseJWS([]byte(token))
+		if err == nil {
+			t.Fatalf("expected '%s' to be rejected", token)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/mattn/go-sqlite3"
@@ -12,27 +15,31 @@ const (
 )
 
 type RegisterRequest struct {
-	Id       string              `json:"id"`
-	Type     string              `json:"type"`
-	RawId    URLEncodedBase64    `json:"rawId"`
-	Response AttestationResponse `json:"response"`
+	Id                     string                 `json:"id"`
+	Type                   string                 `json:"type"`
+	RawId                  URLEncodedBase64       `json:"rawId"`
+	Response               AttestationResponse    `json:"response"`
+	ClientExtensionResults map[string]interface{} `json:"clientExtensionResults"`
 }
 
 type LoginRequest struct {
-	Id       string            `json:"id"`
-	Type     string            `json:"type"`
-	RawId    URLEncodedBase64  `json:"rawId"`
-	Response AssertionResponse `json:"response"`
+	Id                     string                 `json:"id"`
+	Type                   string                 `json:"type"`
+	RawId                  URLEncodedBase64       `json:"rawId"`
+	Response               AssertionResponse      `json:"response"`
+	ClientExtensionResults map[string]interface{} `json:"clientExtensionResults"`
 }
 
 type AuthenticateRequest struct {
 	Identifier string `json:"identifier"`
+	// Name shown to the user when selecting a credential; defaults to the identifier
+	DisplayName string `json:"displayName"`
 }
 
 type UserResponse struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	DisplayName string `json:"displayName"`
+	Id          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
 }
 
 type AllowCredentialResponse struct {
@@ -42,28 +49,57 @@ type AllowCredentialResponse struct {
 }
 
 type AuthenticatorSelectionResponse struct {
-	AuthenticatorAttachment string `json:"authenticatorAttachment"`
+	AuthenticatorAttachment string                 `json:"authenticatorAttachment"`
+	ResidentKey             ResidentKeyRequirement `json:"residentKey"`
+	// Only evaluated by clients that do not know residentKey
+	RequireResidentKey bool                        `json:"requireResidentKey"`
+	UserVerification   UserVerificationRequirement `json:"userVerification"`
 }
 
 type RegisterResponse struct {
-	Challenge                      string                          `json:"challenge"`
+	Challenge                      URLEncodedBase64                `json:"challenge"`
 	RelyingParty                   *RelyingParty                   `json:"rp"`
 	User                           *UserResponse                   `json:"user"`
 	PublicKeyCredentialsParameters []*PublicKeyCredentialParameter `json:"pubKeyCredParams"`
 	AuthenticatorSelection         *AuthenticatorSelectionResponse `json:"authenticatorSelection"`
 	Timeout                        int32                           `json:"timeout"`
-	Attestation                    string                          `json:"attestation"`
+	Attestation                    AttestationConveyancePreference `json:"attestation"`
+	ExcludeCredentials             []AllowCredentialResponse       `json:"excludeCredentials,omitempty"`
+	Extensions                     map[string]interface{}          `json:"extensions,omitempty"`
 }
 
 type LoginResponse struct {
-	Challenge        string                    `json:"challenge"`
-	RelyingPartyId   string                    `json:"rpId"`
-	AllowCredentials []AllowCredentialResponse `json:"allowCredentials"`
-	Timeout          int32                     `json:"timeout"`
+	Challenge        URLEncodedBase64            `json:"challenge"`
+	RelyingPartyId   string                      `json:"rpId"`
+	AllowCredentials []AllowCredentialResponse   `json:"allowCredentials"`
+	UserVerification UserVerificationRequirement `json:"userVerification"`
+	Timeout          int32                       `json:"timeout"`
+	Extensions       map[string]interface{}      `json:"extensions,omitempty"`
+}
+
+type CredentialResponse struct {
+	Id              URLEncodedBase64 `json:"id"`
+	AttestationType AttestationType  `json:"attestationType"`
+	BackupEligible  bool             `json:"backupEligible"`
+	BackupState     bool             `json:"backupState"`
+	// Set if the signature counter of the credential did not increase at a login, so the authenticator may be cloned
+	CloneWarning bool `json:"cloneWarning"`
+}
+
+// CeremonyResultResponse is sent after a successful registration or login.
+type CeremonyResultResponse struct {
+	// Authorizes further requests of the user, e.g. adding another credential
+	AccessKey  string              `json:"accessKey"`
+	Credential *CredentialResponse `json:"credential"`
+	// Set if none of the credentials of the user is backed up, so the user should add another one
+	BackupRecommended bool `json:"backupRecommended"`
 }
 
 func main() {
 	conf, err := ReadConfig()
+	if err != nil {
+		panic(err)
+	}
 
 	db, err := ConnectDB()
 	if err != nil {
@@ -72,20 +108,66 @@ func main() {
 	defer db.Close()
 
 	userRepo := &SqliteUserRepository{db: db}
-	challengeRepo := &InMemoryChallengeRepository{challenges: map[string]interface{}{}}
+	var challengeRepo, usernamelessRepo ChallengeRepository
+	var accessKeyRepo AccessKeyRepository
+	switch conf.Challenge.Store {
+	case ChallengeStoreSqlite:
+		challengeRepo = NewSqliteChallengeRepository(db, conf.Challenge.MaxOutstanding)
+		usernamelessRepo = NewSqliteUsernamelessChallengeRepository(db, conf.Challenge.MaxOutstandingUsernameless)
+		accessKeyRepo = NewSqliteAccessKeyRepository(db)
+	default:
+		challengeRepo = NewInMemoryChallengeRepository(conf.Challenge.MaxOutstanding)
+		usernamelessRepo = NewInMemoryChallengeRepository(conf.Challenge.MaxOutstandingUsernameless)
+		accessKeyRepo = NewInMemoryAccessKeyRepository()
+	}
+	stopSweep := SweepChallenges(challengeRepo, conf.Challenge.TTL())
+	defer stopSweep()
+	stopUsernamelessSweep := SweepChallenges(usernamelessRepo, conf.Challenge.TTL())
+	defer stopUsernamelessSweep()
+
+	webauthn := CreateWebAuthn(conf, userRepo, challengeRepo)
+	webauthn.UseUsernamelessChallengeRepository(usernamelessRepo)
+
+	androidKeyRoots, err := conf.Attestation.RootCertificatePool("android-key")
+	if err != nil {
+		panic(err)
+	}
+	webauthn.RegisterAttestationFormat("android-key", &AndroidKeyAttestationVerifier{Roots: androidKeyRoots})
+
+	safetyNetRoots, err := conf.Attestation.RootCertificatePool("android-safetynet")
+	if err != nil {
+		panic(err)
+	}
+	webauthn.RegisterAttestationFormat("android-safetynet", &AndroidSafetyNetAttestationVerifier{Roots: safetyNetRoots})
+
+	appleRoots, err := conf.Attestation.RootCertificatePool("apple")
+	if err != nil {
+		panic(err)
+	}
+	webauthn.RegisterAttestationFormat("apple", &AppleAttestationVerifier{Roots: appleRoots})
 
-	webauthn := CreateWebAuthn(&conf.RelyingParty, conf.Authenticator, conf.PublicKeyCredentialParams, challengeRepo)
+	metadata, err := conf.Metadata.LoadService()
+	if err != nil {
+		panic(err)
+	}
+	if metadata != nil {
+		if metadata.NextUpdate.Before(time.Now()) {
+			fmt.Printf("Metadata BLOB %d is outdated since %s\n", metadata.Number, metadata.NextUpdate.Format("2006-01-02"))
+		}
+		webauthn.UseMetadataService(metadata)
+	}
 
 	router := gin.Default()
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = conf.Cors.Origin
 	config.ExposeHeaders = conf.Cors.Headers
+	config.AddAllowHeaders("Authorization")
 
 	router.Use(cors.New(config))
 
 	authenticationController := AuthenticationController{}
-	authenticationController.Init(userRepo, challengeRepo, webauthn)
+	authenticationController.Init(userRepo, accessKeyRepo, webauthn)
 	authenticationController.Routes(router.Group("authenticate"))
 
 	router.Run()
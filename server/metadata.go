@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthenticatorStatus is the status of an authenticator model as reported by the FIDO Metadata Service.
+// See https://fidoalliance.org/specs/mds/fido-metadata-service-v3.0-ps-20210518.html#authenticatorstatus-enum
+type AuthenticatorStatus string
+
+const (
+	StatusNotFIDOCertified          AuthenticatorStatus = "NOT_FIDO_CERTIFIED"
+	StatusFIDOCertified             AuthenticatorStatus = "FIDO_CERTIFIED"
+	StatusUserVerificationBypass    AuthenticatorStatus = "USER_VERIFICATION_BYPASS"
+	StatusAttestationKeyCompromise  AuthenticatorStatus = "ATTESTATION_KEY_COMPROMISE"
+	StatusUserKeyRemoteCompromise   AuthenticatorStatus = "USER_KEY_REMOTE_COMPROMISE"
+	StatusUserKeyPhysicalCompromise AuthenticatorStatus = "USER_KEY_PHYSICAL_COMPROMISE"
+	StatusUpdateAvailable           AuthenticatorStatus = "UPDATE_AVAILABLE"
+	StatusRevoked                   AuthenticatorStatus = "REVOKED"
+	StatusSelfAssertionSubmitted    AuthenticatorStatus = "SELF_ASSERTION_SUBMITTED"
+	StatusFIDOCertifiedL1           AuthenticatorStatus = "FIDO_CERTIFIED_L1"
+	StatusFIDOCertifiedL1Plus       AuthenticatorStatus = "FIDO_CERTIFIED_L1plus"
+	StatusFIDOCertifiedL2           AuthenticatorStatus = "FIDO_CERTIFIED_L2"
+	StatusFIDOCertifiedL2Plus       AuthenticatorStatus = "FIDO_CERTIFIED_L2plus"
+	StatusFIDOCertifiedL3           AuthenticatorStatus = "FIDO_CERTIFIED_L3"
+	StatusFIDOCertifiedL3Plus       AuthenticatorStatus = "FIDO_CERTIFIED_L3plus"
+)
+
+// IsCompromised tells whether the status indicates that authenticators of the model can not be trusted.
+func (status AuthenticatorStatus) IsCompromised() bool {
+	switch status {
+	case StatusUserVerificationBypass, StatusAttestationKeyCompromise, StatusUserKeyRemoteCompromise, StatusUserKeyPhysicalCompromise, StatusRevoked:
+		return true
+	default:
+		return false
+	}
+}
+
+type StatusReport struct {
+	Status        AuthenticatorStatus `json:"status"`
+	EffectiveDate string              `json:"effectiveDate"`
+	Url           string              `json:"url"`
+}
+
+// MetadataStatement holds the parts of an authenticator metadata statement used for trust decisions.
+// See https://fidoalliance.org/specs/mds/fido-metadata-statement-v3.0-ps-20210518.html
+type MetadataStatement struct {
+	Description                 string   `json:"description"`
+	AAGUID                      string   `json:"aaguid"`
+	AttestationTypes            []string `json:"attestationTypes"`
+	AttestationRootCertificates []string `json:"attestationRootCertificates"`
+}
+
+// MetadataEntry describes a single authenticator model of the metadata BLOB.
+type MetadataEntry struct {
+	AAGUID                               string             `json:"aaguid"`
+	AttestationCertificateKeyIdentifiers []string           `json:"attestationCertificateKeyIdentifiers"`
+	MetadataStatement                    *MetadataStatement `json:"metadataStatement"`
+	StatusReports                        []StatusReport     `json:"statusReports"`
+	TimeOfLastStatusChange               string             `json:"timeOfLastStatusChange"`
+}
+
+// IsCompromised tells whether the most recent status report of the authenticator model indicates a compromise.
+// A model may be certified again after a compromise was fixed, so earlier reports no longer apply.
+func (entry *MetadataEntry) IsCompromised() bool {
+	report := entry.latestStatusReport()
+	return report != nil && report.Status.IsCompromised()
+}
+
+// latestStatusReport returns the status report with the latest effective date, or nil if there is none.
+// Reports without a valid effective date count as the oldest; of reports with the same date the last one wins,
+// as the metadata service lists them in chronological order.
+func (entry *MetadataEntry) latestStatusReport() *StatusReport {
+	var latest *StatusReport
+	var latestDate time.Time
+	for i := range entry.StatusReports {
+		report := &entry.StatusReports[i]
+		effectiveDate, _ := time.Parse("2006-01-02", report.EffectiveDate)
+		if latest == nil || !effectiveDate.Before(latestDate) {
+			latest = report
+			latestDate = effectiveDate
+		}
+	}
+	return latest
+}
+
+// RootCertificates returns the attestation root certificates trusted for the authenticator model.
+func (entry *MetadataEntry) RootCertificates() (*x509.CertPool, error) {
+	if entry.MetadataStatement == nil || len(entry.MetadataStatement.AttestationRootCertificates) == 0 {
+		return nil, errors.New("Metadata entry does not contain attestation root certificates")
+	}
+
+	pool := x509.NewCertPool()
+	for _, encoded := range entry.MetadataStatement.AttestationRootCertificates {
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode attestation root certificate: %w", err)
+		}
+
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse attestation root certificate: %w", err)
+		}
+		pool.AddCert(certificate)
+	}
+	return pool, nil
+}
+
+// supportsAttestationType tells whether the metadata statement lists the given attestation type,
+// using the identifiers of the FIDO registry.
+func (entry *MetadataEntry) supportsAttestationType(attestationType string) bool {
+	if entry.MetadataStatement == nil {
+		return false
+	}
+	for _, supported := range entry.MetadataStatement.AttestationTypes {
+		if supported == attestationType {
+			return true
+		}
+	}
+	return false
+}
+
+type MetadataBLOBPayload struct {
+	LegalHeader string          `json:"legalHeader"`
+	Number      int             `json:"no"`
+	NextUpdate  string          `json:"nextUpdate"`
+	Entries     []MetadataEntry `json:"entries"`
+}
+
+// MetadataService provides metadata about authenticator models.
+type MetadataService interface {
+	// FindByAAGUID returns the entry of the authenticator model with the given AAGUID, or nil if it is unknown.
+	FindByAAGUID(aaguid []byte) *MetadataEntry
+	// FindByAttestationCertificate returns the entry listing the key identifier of the given certificate, or
+	// nil if it is unknown. This is used for U2F authenticators, which do not have an AAGUID.
+	FindByAttestationCertificate(certificate *x509.Certificate) *MetadataEntry
+}
+
+// BLOBMetadataService serves metadata from a FIDO Metadata Service (MDS3) BLOB.
+// See https://fidoalliance.org/specs/mds/fido-metadata-service-v3.0-ps-20210518.html
+type BLOBMetadataService struct {
+	Number     int
+	NextUpdate time.Time
+	byAAGUID   map[string]*MetadataEntry
+	byKeyId    map[string]*MetadataEntry
+}
+
+// LoadMetadataBLOB reads a metadata BLOB from a file and verifies its signature against the given roots.
+// Revocation of the BLOB signing certificates is not checked, so the BLOB can be used fully offline.
+func LoadMetadataBLOB(path string, roots *x509.CertPool, now time.Time) (*BLOBMetadataService, error) {
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jws, err := ParseJWS(token)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := parseCertificateChain(jws.Header.Certificates)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse metadata BLOB certificates: %w", err)
+	}
+
+	err = verifyCertificateChain(certificates, roots, now)
+	if err != nil {
+		return nil, fmt.Errorf("Metadata BLOB certificates are not trusted: %w", err)
+	}
+
+	err = jws.Verify(certificates[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var payload MetadataBLOBPayload
+	err = json.Unmarshal(jws.Payload, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse metadata BLOB payload: %w", err)
+	}
+
+	return NewBLOBMetadataService(&payload)
+}
+
+// NewBLOBMetadataService indexes the entries of an already verified metadata BLOB payload.
+func NewBLOBMetadataService(payload *MetadataBLOBPayload) (*BLOBMetadataService, error) {
+	nextUpdate, err := time.Parse("2006-01-02", payload.NextUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse nextUpdate of metadata BLOB: %w", err)
+	}
+
+	service := &BLOBMetadataService{
+		Number:     payload.Number,
+		NextUpdate: nextUpdate,
+		byAAGUID:   map[string]*MetadataEntry{},
+		byKeyId:    map[string]*MetadataEntry{},
+	}
+
+	for i := range payload.Entries {
+		entry := &payload.Entries[i]
+		if entry.AAGUID != "" {
+			service.byAAGUID[strings.ToLower(entry.AAGUID)] = entry
+		}
+		for _, keyId := range entry.AttestationCertificateKeyIdentifiers {
+			service.byKeyId[strings.ToLower(keyId)] = entry
+		}
+	}
+	return service, nil
+}
+
+func (service *BLOBMetadataService) FindByAAGUID(aaguid []byte) *MetadataEntry {
+	return service.byAAGUID[FormatAAGUID(aaguid)]
+}
+
+func (service *BLOBMetadataService) FindByAttestationCertificate(certificate *x509.Certificate) *MetadataEntry {
+	keyId, err := certificateKeyIdentifier(certificate)
+	if err != nil {
+		return nil
+	}
+	return service.byKeyId[keyId]
+}
+
+// FormatAAGUID formats an AAGUID in the UUID notation used by the metadata service.
+func FormatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return hex.EncodeToString(aaguid)
+	}
+	encoded := hex.EncodeToString(aaguid)
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:32]
+}
+
+// certificateKeyIdentifier computes the hex encoded SHA-1 hash of the certificate public key, as used by the
+// metadata service to identify U2F attestation certificates.
+func certificateKeyIdentifier(certificate *x509.Certificate) (string, error) {
+	var subjectPublicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(certificate.RawSubjectPublicKeyInfo, &subjectPublicKeyInfo); err != nil {
+		return "", err
+	}
+
+	keyId := sha1.Sum(subjectPublicKeyInfo.PublicKey.Bytes)
+	return hex.EncodeToString(keyId[:]), nil
+}
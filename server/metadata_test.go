@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAAGUID = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+// testMetadataSigner signs metadata BLOBs with a certificate issued by its own root.
+type testMetadataSigner struct {
+	roots       *x509.CertPool
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newTestMetadataSigner(t *testing.T) *testMetadataSigner {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Metadata Root"}, true, rootKey, nil, nil)
+	key := newTestKey(t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &testMetadataSigner{
+		roots:       roots,
+		key:         key,
+		certificate: newTestCertificate(t, pkix.Name{CommonName: "Test Metadata Signer"}, false, key, root, rootKey),
+	}
+}
+
+// sign creates an ES256 signed BLOB of the payload and writes it to a temporary file.
+func (signer *testMetadataSigner) sign(t *testing.T, payload *MetadataBLOBPayload) string {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "blob.jwt")
+	err = os.WriteFile(path, signTestJWS(t, "ES256", signer.key, []*x509.Certificate{signer.certificate}, body), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testMetadataPayload lists a single authenticator model with the given attestation root.
+func testMetadataPayload(root *x509.Certificate) *MetadataBLOBPayload {
+	return &MetadataBLOBPayload{
+		Number:     42,
+		NextUpdate: time.Now().AddDate(0, 1, 0).Format("2006-01-02"),
+		Entries: []MetadataEntry{{
+			AAGUID: FormatAAGUID(testAAGUID),
+			MetadataStatement: &MetadataStatement{
+				Description:                 "Test Authenticator",
+				AAGUID:                      FormatAAGUID(testAAGUID),
+				AttestationTypes:            []string{"basic_full"},
+				AttestationRootCertificates: []string{base64.StdEncoding.EncodeToString(root.Raw)},
+			},
+			StatusReports: []StatusReport{{Status: StatusFIDOCertified}},
+		}},
+	}
+}
+
+func TestLoadMetadataBLOB(t *testing.T) {
+	signer := newTestMetadataSigner(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, newTestKey(t), nil, nil)
+	path := signer.sign(t, testMetadataPayload(root))
+
+	service, err := LoadMetadataBLOB(path, signer.roots, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.Number != 42 {
+		t.Fatalf("expected BLOB number 42, got %d", service.Number)
+	}
+
+	entry := service.FindByAAGUID(testAAGUID)
+	if entry == nil || entry.MetadataStatement.Description != "Test Authenticator" {
+		t.Fatalf("expected entry of the test authenticator, got %+v", entry)
+	}
+	if service.FindByAAGUID(make([]byte, 16)) != nil {
+		t.Fatal("expected no entry for an unknown AAGUID")
+	}
+}
+
+func TestLoadMetadataBLOBOfUntrustedSigner(t *testing.T) {
+	signer := newTestMetadataSigner(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, newTestKey(t), nil, nil)
+	path := signer.sign(t, testMetadataPayload(root))
+
+	_, err := LoadMetadataBLOB(path, newTestMetadataSigner(t).roots, time.Now())
+	if err == nil {
+		t.Fatal("expected BLOB of an untrusted signer to be rejected")
+	}
+}
+
+func TestLoadMetadataBLOBWithModifiedPayload(t *testing.T) {
+	signer := newTestMetadataSigner(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, newTestKey(t), nil, nil)
+	path := signer.sign(t, testMetadataPayload(root))
+
+	token, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(string(token), ".")
+	payload, err := json.Marshal(&MetadataBLOBPayload{Number: 43, NextUpdate: "2099-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	err = os.WriteFile(path, []byte(strings.Join(parts, ".")), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadMetadataBLOB(path, signer.roots, time.Now())
+	if err == nil {
+		t.Fatal("expected BLOB with a modified payload to be rejected")
+	}
+}
+
+// newTestMetadataWebAuthn creates a relying party whose metadata knows the test authenticator with the given root.
+func newTestMetadataWebAuthn(t *testing.T, root *x509.Certificate) *WebAuthn {
+	t.Helper()
+
+	metadata, err := NewBLOBMetadataService(testMetadataPayload(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webauthn := newTestWebAuthn(t, nil)
+	webauthn.UseMetadataService(metadata)
+	return webauthn
+}
+
+func TestRegisterWithAttestationOfKnownAuthenticator(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, rootKey, nil, nil)
+	attestationKey := newTestKey(t)
+	attestationCertificate := newTestCertificate(t, packedAttestationSubject, false, attestationKey, root, rootKey)
+
+	webauthn := newTestMetadataWebAuthn(t, root)
+	authenticator := newTestAuthenticator(t)
+	authenticator.aaguid = testAAGUID
+
+	user := registerTestUser(t, webauthn, authenticator, packedAttestation(t, attestationKey, attestationCertificate))
+
+	if user.Credentials[0].AttestationType != AttestationTypeBasic {
+		t.Fatalf("expected basic attestation, got %s", user.Credentials[0].AttestationType)
+	}
+}
+
+func TestRegisterWithAttestationOfUnknownAuthenticator(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, rootKey, nil, nil)
+	attestationKey := newTestKey(t)
+	attestationCertificate := newTestCertificate(t, packedAttestationSubject, false, attestationKey, root, rootKey)
+
+	webauthn := newTestMetadataWebAuthn(t, root)
+	authenticator := newTestAuthenticator(t)
+	authenticator.aaguid = []byte{0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xf9, 0xf8, 0xf7, 0xf6, 0xf5, 0xf4, 0xf3, 0xf2, 0xf1, 0xf0}
+
+	user := registerTestUser(t, webauthn, authenticator, packedAttestation(t, attestationKey, attestationCertificate))
+
+	if user.Credentials[0].AttestationType != AttestationTypeSelf {
+		t.Fatalf("expected attestation of unknown authenticator to be treated as self attestation, got %s", user.Credentials[0].AttestationType)
+	}
+}
+
+func TestRegisterWithForgedAttestationOfKnownAuthenticator(t *testing.T) {
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, newTestKey(t), nil, nil)
+	attestationKey := newTestKey(t)
+	forged := newTestCertificate(t, packedAttestationSubject, false, attestationKey, nil, nil)
+
+	webauthn := newTestMetadataWebAuthn(t, root)
+	authenticator := newTestAuthenticator(t)
+	authenticator.aaguid = testAAGUID
+
+	options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, packedAttestation(t, attestationKey, forged))
+	_, err = webauthn.FinishRegister(request)
+	if err == nil {
+		t.Fatal("expected forged attestation of a known authenticator to be rejected")
+	}
+}
+
+func TestMetadataEntryIsCompromised(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		reports     []StatusReport
+		compromised bool
+	}{
+		{"no reports", nil, false},
+		{"certified", []StatusReport{{Status: StatusFIDOCertified, EffectiveDate: "2021-01-01"}}, false},
+		{
+			"compromised",
+			[]StatusReport{
+				{Status: StatusFIDOCertified, EffectiveDate: "2021-01-01"},
+				{Status: StatusAttestationKeyCompromise, EffectiveDate: "2022-01-01"},
+			},
+			true,
+		},
+		{
+			"recertified after compromise",
+			[]StatusReport{
+				{Status: StatusFIDOCertified, EffectiveDate: "2021-01-01"},
+				{Status: StatusAttestationKeyCompromise, EffectiveDate: "2022-01-01"},
+				{Status: StatusFIDOCertifiedL1, EffectiveDate: "2023-01-01"},
+			},
+			false,
+		},
+		{
+			"compromise listed before earlier certification",
+			[]StatusReport{
+				{Status: StatusRevoked, EffectiveDate: "2022-01-01"},
+				{Status: StatusFIDOCertified, EffectiveDate: "2021-01-01"},
+			},
+			true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &MetadataEntry{StatusReports: test.reports}
+			if entry.IsCompromised() != test.compromised {
+				t.Fatalf("expected compromised to be %v", test.compromised)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+)
+
+// NoneAttestationVerifier implements the verification procedure of the none attestation statement format.
+// It is used when the authenticator does not provide attestation or the client replaced it.
+// See https://w3c.github.io/webauthn/#sctn-none-attestation
+type NoneAttestationVerifier struct{}
+
+func (verifier *NoneAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt map[string]interface{}
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attStmt) != 0 {
+		return nil, errors.New("None attestation statement must be empty")
+	}
+
+	return &AttestationResult{Type: AttestationTypeNone}, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Prefixes of origins of native apps, which are not web origins
+const (
+	androidOriginPrefix = "android:apk-key-hash:"
+	iosOriginPrefix     = "ios:bundle-id:"
+)
+
+// Errors reported when verifying the origin of the client data
+var (
+	ErrCrossOriginNotAllowed = errors.New("Ceremonies in cross-origin iframes are not allowed")
+	ErrInvalidTopOrigin      = errors.New("Top origin is not allowed")
+)
+
+// OriginConfig decides which origins may perform ceremonies.
+// See https://w3c.github.io/webauthn/#sctn-validating-origin
+type OriginConfig struct {
+	// Exact origins allowed to perform ceremonies, e.g. "https://login.example.com" or
+	// "android:apk-key-hash:<hash>" for Android apps
+	Allowed []string `json:"allowed"`
+	// Whether ceremonies may run in iframes embedded by another origin
+	AllowCrossOrigin bool `json:"allowCrossOrigin"`
+	// Exact origins allowed to embed ceremonies in an iframe; only used if cross-origin ceremonies are allowed
+	AllowedTopOrigins []string `json:"allowedTopOrigins"`
+}
+
+func (config *OriginConfig) validate() error {
+	if len(config.Allowed) == 0 {
+		return errors.New("No allowed origins configured")
+	}
+
+	for _, origin := range append(config.Allowed, config.AllowedTopOrigins...) {
+		err := validateOrigin(origin)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateOrigin(origin string) error {
+	if strings.HasPrefix(origin, androidOriginPrefix) || strings.HasPrefix(origin, iosOriginPrefix) {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("Invalid origin '%s': %w", origin, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("Invalid origin '%s': expected scheme and host only", origin)
+	}
+	return nil
+}
+
+// Verify checks the origin of the client data and whether the ceremony ran in an iframe of another origin.
+func (config *OriginConfig) Verify(clientData ClientData) error {
+	if !containsOrigin(config.Allowed, clientData.Origin) {
+		return fmt.Errorf("%w; got '%s'", ErrInvalidOrigin, clientData.Origin)
+	}
+
+	if !clientData.CrossOrigin {
+		if clientData.TopOrigin != "" && clientData.TopOrigin != clientData.Origin {
+			return fmt.Errorf("%w; got '%s'", ErrInvalidTopOrigin, clientData.TopOrigin)
+		}
+		return nil
+	}
+
+	if !config.AllowCrossOrigin {
+		return ErrCrossOriginNotAllowed
+	}
+
+	if !containsOrigin(config.AllowedTopOrigins, clientData.TopOrigin) {
+		return fmt.Errorf("%w; got '%s'", ErrInvalidTopOrigin, clientData.TopOrigin)
+	}
+	return nil
+}
+
+func containsOrigin(origins []string, origin string) bool {
+	for _, allowed := range origins {
+		if strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
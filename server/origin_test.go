@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOriginMustMatchExactly(t *testing.T) {
+	config := &OriginConfig{Allowed: []string{"https://localhost", "android:apk-key-hash:abc"}}
+
+	for _, origin := range []string{"https://localhost", "android:apk-key-hash:abc"} {
+		err := config.Verify(ClientData{Origin: origin})
+		if err != nil {
+			t.Fatalf("expected '%s' to be allowed, got %v", origin, err)
+		}
+	}
+
+	for _, origin := range []string{"https://localhost.evil.com", "http://localhost", "https://evil.com/localhost"} {
+		err := config.Verify(ClientData{Origin: origin})
+		if !errors.Is(err, ErrInvalidOrigin) {
+			t.Fatalf("expected '%s' to be rejected, got %v", origin, err)
+		}
+	}
+}
+
+func TestCrossOriginPolicy(t *testing.T) {
+	config := &OriginConfig{Allowed: []string{"https://login.example.com"}}
+	clientData := ClientData{Origin: "https://login.example.com", CrossOrigin: true, TopOrigin: "https://shop.example.com"}
+
+	err := config.Verify(clientData)
+	if !errors.Is(err, ErrCrossOriginNotAllowed) {
+		t.Fatalf("expected ErrCrossOriginNotAllowed, got %v", err)
+	}
+
+	config.AllowCrossOrigin = true
+	err = config.Verify(clientData)
+	if !errors.Is(err, ErrInvalidTopOrigin) {
+		t.Fatalf("expected ErrInvalidTopOrigin, got %v", err)
+	}
+
+	config.AllowedTopOrigins = []string{"https://shop.example.com"}
+	err = config.Verify(clientData)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
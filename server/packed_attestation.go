@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+const attestationCertificateOU = "Authenticator Attestation"
+
+type PackedAttestationStatement struct {
+	Algorithm    int      `cbor:"alg"`
+	Signature    []byte   `cbor:"sig"`
+	Certificates [][]byte `cbor:"x5c,omitempty"`
+}
+
+// PackedAttestationVerifier implements the verification procedure of the packed attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-packed-attestation
+type PackedAttestationVerifier struct{}
+
+func (verifier *PackedAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt PackedAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	signedData := append(append([]byte{}, attestationObject.RawAuthnData...), clientDataHash...)
+
+	if len(attStmt.Certificates) == 0 {
+		publicKey, err := attestationObject.CredentialPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		return verifyPackedSelfAttestation(attStmt, signedData, publicKey)
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	attestationCertificate := certificates[0]
+
+	// Verify that sig is a valid signature over the concatenation of authenticatorData and
+	// clientDataHash using the attestation public key in attestnCert with the algorithm specified in alg.
+	err = verifyAttestationSignature(attestationCertificate, COSEAlgorithmIdentifier(attStmt.Algorithm), signedData, attStmt.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyPackedCertificate(attestationCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCertificateAAGUID(attestationCertificate, attestationObject.AuthnData.AttData.AAGUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing vouches for the attestation certificate yet, so basic attestation is only claimed until the
+	// trust path is verified against the roots of the authenticator model
+	return &AttestationResult{
+		Type:      AttestationTypeBasic,
+		TrustPath: certificates,
+	}, nil
+}
+
+// verifyPackedSelfAttestation verifies a packed attestation statement without x5c, that is signed
+// by the credential private key itself.
+func verifyPackedSelfAttestation(attStmt PackedAttestationStatement, signedData []byte, publicKey PublicKey) (*AttestationResult, error) {
+	if publicKey.GetAlgorithm() != attStmt.Algorithm {
+		return nil, fmt.Errorf("Algorithms do not match %d != %d", publicKey.GetAlgorithm(), attStmt.Algorithm)
+	}
+
+	ok, err := publicKey.Verify(signedData, attStmt.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("Self attestation signature is invalid")
+	}
+
+	return &AttestationResult{Type: AttestationTypeSelf}, nil
+}
+
+// verifyPackedCertificate checks the attestation certificate against the requirements for the
+// packed attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-packed-attestation-cert-requirements
+func verifyPackedCertificate(certificate *x509.Certificate) error {
+	if certificate.Version != 3 {
+		return fmt.Errorf("Attestation certificate must be version 3; got version %d", certificate.Version)
+	}
+
+	subject := certificate.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" {
+		return errors.New("Attestation certificate subject is missing C, O or CN")
+	}
+
+	if len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != attestationCertificateOU {
+		return fmt.Errorf("Attestation certificate OU must be '%s'; got %v", attestationCertificateOU, subject.OrganizationalUnit)
+	}
+
+	// The basic constraints extension must be present with the CA component set to false
+	if !certificate.BasicConstraintsValid || certificate.IsCA {
+		return errors.New("Attestation certificate must have basic constraints of a non-CA certificate")
+	}
+
+	return nil
+}
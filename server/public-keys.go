@@ -66,6 +66,7 @@ const (
 	SHA256WithRSAPSS
 	SHA384WithRSAPSS
 	SHA512WithRSAPSS
+	PureEd25519
 )
 
 var SignatureAlgorithmDetails = []struct {
@@ -84,7 +85,7 @@ var SignatureAlgorithmDetails = []struct {
 	{ECDSAWithSHA256, AlgES256, "ECDSA-SHA256", crypto.SHA256.New},
 	{ECDSAWithSHA384, AlgES384, "ECDSA-SHA384", crypto.SHA384.New},
 	{ECDSAWithSHA512, AlgES512, "ECDSA-SHA512", crypto.SHA512.New},
-	{UnknownSignatureAlgorithm, AlgEdDSA, "EdDSA", crypto.SHA512.New},
+	{PureEd25519, AlgEdDSA, "EdDSA", crypto.SHA512.New},
 }
 
 // Return the Hashing interface to be used for a given COSE Algorithm
@@ -98,6 +99,16 @@ func HasherFromCOSEAlg(coseAlg COSEAlgorithmIdentifier) func() hash.Hash {
 	return crypto.SHA256.New
 }
 
+// Return the SignatureAlgorithm matching a given COSE Algorithm. The values line up with x509.SignatureAlgorithm.
+func SigAlgFromCOSEAlg(coseAlg COSEAlgorithmIdentifier) SignatureAlgorithm {
+	for _, details := range SignatureAlgorithmDetails {
+		if details.coseAlg == coseAlg {
+			return details.algo
+		}
+	}
+	return UnknownSignatureAlgorithm
+}
+
 type PublicKey interface {
 	Verify([]byte, []byte) (bool, error)
 	GetAlgorithm() int
@@ -112,7 +123,7 @@ type PublicKey interface {
 // COSE data.
 type PublicKeyData struct {
 	// Decode the results to int by default.
-	_struct bool `cbor:",keyasint" json:"public_key"`
+	_struct bool `cbor:",keyasint"`
 	// The type of key created. Should be OKP, EC2, or RSA.
 	KeyType int `cbor:"1,keyasint" json:"kty"`
 	// A COSEAlgorithmIdentifier for the algorithm used to derive the key signature.
@@ -263,3 +274,38 @@ func ParsePublicKey(keyBytes []byte) (PublicKey, error) {
 		return nil, errors.New("unsupported key")
 	}
 }
+
+// Convert the COSE public key into its counterpart of the crypto packages, e.g. to compare it
+// with the public key of a certificate
+func ToCryptoPublicKey(key PublicKey) (crypto.PublicKey, error) {
+	switch k := key.(type) {
+	case *EC2PublicKeyData:
+		var curve elliptic.Curve
+		switch k.Curve {
+		case 1: // IANA COSE code for P-256
+			curve = elliptic.P256()
+		case 2: // IANA COSE code for P-384
+			curve = elliptic.P384()
+		case 3: // IANA COSE code for P-521
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     big.NewInt(0).SetBytes(k.XCoord),
+			Y:     big.NewInt(0).SetBytes(k.YCoord),
+		}, nil
+	case *RSAPublicKeyData:
+		return &rsa.PublicKey{
+			N: big.NewInt(0).SetBytes(k.Modulus),
+			E: int(big.NewInt(0).SetBytes(k.Exponent).Int64()),
+		}, nil
+	case *OKPPublicKeyData:
+		var publicKey ed25519.PublicKey = make([]byte, ed25519.PublicKeySize)
+		copy(publicKey, k.XCoord)
+		return publicKey, nil
+	default:
+		return nil, errors.New("unsupported key")
+	}
+}
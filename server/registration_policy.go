@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RegistrationRejectionReason identifies why a registration policy rejected a credential.
+type RegistrationRejectionReason string
+
+const (
+	RejectionAAGUIDNotAllowed         RegistrationRejectionReason = "aaguid_not_allowed"
+	RejectionAAGUIDNotVerified        RegistrationRejectionReason = "aaguid_not_verified"
+	RejectionAAGUIDDenied             RegistrationRejectionReason = "aaguid_denied"
+	RejectionAttestationTooWeak       RegistrationRejectionReason = "attestation_too_weak"
+	RejectionAuthenticatorCompromised RegistrationRejectionReason = "authenticator_compromised"
+)
+
+// RegistrationRejection is returned when a credential was verified successfully, but the registration
+// policy does not accept the authenticator.
+type RegistrationRejection struct {
+	Reason  RegistrationRejectionReason
+	Message string
+}
+
+func (rejection *RegistrationRejection) Error() string {
+	return fmt.Sprintf("Registration rejected (%s): %s", rejection.Reason, rejection.Message)
+}
+
+// attestationStrength orders the attestation types for the minimum attestation requirement.
+var attestationStrength = map[AttestationType]int{
+	AttestationTypeNone:   0,
+	AttestationTypeSelf:   1,
+	AttestationTypeBasic:  2,
+	AttestationTypeAttCA:  3,
+	AttestationTypeAnonCA: 3,
+}
+
+// RegistrationPolicy decides which authenticators may be registered.
+// The AAGUID is only trustworthy if the attestation chains up to a trusted root, so authenticators on the
+// allow list are rejected unless their attestation is trusted.
+type RegistrationPolicy struct {
+	// If not empty, only authenticators with one of these AAGUIDs may be registered
+	AllowedAAGUIDs []string `json:"allowedAAGUIDs"`
+	// Authenticators with one of these AAGUIDs may not be registered
+	DeniedAAGUIDs []string `json:"deniedAAGUIDs"`
+	// The weakest attestation type that is accepted; defaults to none
+	MinimumAttestation AttestationType `json:"minimumAttestation"`
+	// Whether authenticators with a compromised metadata status are rejected
+	RejectCompromised bool `json:"rejectCompromised"`
+}
+
+// RegistrationPolicyConfig holds the default registration policy and policies for individual users.
+type RegistrationPolicyConfig struct {
+	Default RegistrationPolicy            `json:"default"`
+	Users   map[string]RegistrationPolicy `json:"users"`
+}
+
+// For returns the policy applying to the user with the given identifier.
+func (config *RegistrationPolicyConfig) For(identifier string) *RegistrationPolicy {
+	if policy, ok := config.Users[identifier]; ok {
+		return &policy
+	}
+	return &config.Default
+}
+
+func (config *RegistrationPolicyConfig) validate() error {
+	err := config.Default.validate()
+	if err != nil {
+		return err
+	}
+
+	for identifier, policy := range config.Users {
+		err = policy.validate()
+		if err != nil {
+			return fmt.Errorf("Registration policy of '%s': %w", identifier, err)
+		}
+		config.Users[identifier] = policy
+	}
+	return nil
+}
+
+func (policy *RegistrationPolicy) validate() error {
+	if policy.MinimumAttestation == "" {
+		policy.MinimumAttestation = AttestationTypeNone
+	}
+
+	if _, ok := attestationStrength[policy.MinimumAttestation]; !ok {
+		return fmt.Errorf("Unknown minimum attestation type '%s'", policy.MinimumAttestation)
+	}
+	return nil
+}
+
+// Evaluate checks the verified attestation of an authenticator against the policy.
+func (policy *RegistrationPolicy) Evaluate(aaguid []byte, attestation *AttestationResult) error {
+	formattedAAGUID := FormatAAGUID(aaguid)
+
+	if containsAAGUID(policy.DeniedAAGUIDs, formattedAAGUID) {
+		return &RegistrationRejection{
+			Reason:  RejectionAAGUIDDenied,
+			Message: fmt.Sprintf("Authenticator '%s' is not allowed", formattedAAGUID),
+		}
+	}
+
+	if len(policy.AllowedAAGUIDs) > 0 && !containsAAGUID(policy.AllowedAAGUIDs, formattedAAGUID) {
+		return &RegistrationRejection{
+			Reason:  RejectionAAGUIDNotAllowed,
+			Message: fmt.Sprintf("Authenticator '%s' is not on the list of approved authenticators", formattedAAGUID),
+		}
+	}
+
+	if len(policy.AllowedAAGUIDs) > 0 && !attestation.Trusted {
+		return &RegistrationRejection{
+			Reason:  RejectionAAGUIDNotVerified,
+			Message: fmt.Sprintf("Authenticator '%s' could not be verified to be an approved authenticator", formattedAAGUID),
+		}
+	}
+
+	attestationType := attestation.VerifiedType()
+	if attestationStrength[attestationType] < attestationStrength[policy.MinimumAttestation] {
+		return &RegistrationRejection{
+			Reason:  RejectionAttestationTooWeak,
+			Message: fmt.Sprintf("Attestation type '%s' is weaker than the required '%s'", attestationType, policy.MinimumAttestation),
+		}
+	}
+
+	if policy.RejectCompromised && attestation.Metadata != nil && attestation.Metadata.IsCompromised() {
+		return &RegistrationRejection{
+			Reason:  RejectionAuthenticatorCompromised,
+			Message: fmt.Sprintf("Authenticator '%s' is reported as compromised", formattedAAGUID),
+		}
+	}
+
+	return nil
+}
+
+func containsAAGUID(aaguids []string, aaguid string) bool {
+	for _, candidate := range aaguids {
+		if strings.EqualFold(candidate, aaguid) {
+			return true
+		}
+	}
+	return false
+}
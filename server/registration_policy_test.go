@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+)
+
+func TestRegistrationPolicyEvaluate(t *testing.T) {
+	otherAAGUID := make([]byte, 16)
+	trustPath := []*x509.Certificate{{}}
+	compromised := &MetadataEntry{StatusReports: []StatusReport{{Status: StatusAttestationKeyCompromise}}}
+
+	tests := []struct {
+		name        string
+		policy      RegistrationPolicy
+		aaguid      []byte
+		attestation AttestationResult
+		reason      RegistrationRejectionReason
+	}{
+		{"empty policy", RegistrationPolicy{}, testAAGUID, AttestationResult{Type: AttestationTypeNone}, ""},
+		{"denied", RegistrationPolicy{DeniedAAGUIDs: []string{FormatAAGUID(testAAGUID)}}, testAAGUID, AttestationResult{Type: AttestationTypeNone}, RejectionAAGUIDDenied},
+		{"not allowed", RegistrationPolicy{AllowedAAGUIDs: []string{FormatAAGUID(testAAGUID)}}, otherAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath, Trusted: true}, RejectionAAGUIDNotAllowed},
+		{"allowed", RegistrationPolicy{AllowedAAGUIDs: []string{FormatAAGUID(testAAGUID)}}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath, Trusted: true}, ""},
+		{"allowed without attestation", RegistrationPolicy{AllowedAAGUIDs: []string{FormatAAGUID(testAAGUID)}}, testAAGUID, AttestationResult{Type: AttestationTypeNone}, RejectionAAGUIDNotVerified},
+		{"allowed with untrusted attestation", RegistrationPolicy{AllowedAAGUIDs: []string{FormatAAGUID(testAAGUID)}}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath}, RejectionAAGUIDNotVerified},
+		{"trusted basic", RegistrationPolicy{MinimumAttestation: AttestationTypeBasic}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath, Trusted: true}, ""},
+		{"untrusted basic", RegistrationPolicy{MinimumAttestation: AttestationTypeBasic}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath}, RejectionAttestationTooWeak},
+		{"untrusted attca", RegistrationPolicy{MinimumAttestation: AttestationTypeSelf}, testAAGUID, AttestationResult{Type: AttestationTypeAttCA, TrustPath: trustPath}, ""},
+		{"none below self", RegistrationPolicy{MinimumAttestation: AttestationTypeSelf}, testAAGUID, AttestationResult{Type: AttestationTypeNone}, RejectionAttestationTooWeak},
+		{"compromised", RegistrationPolicy{RejectCompromised: true}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath, Trusted: true, Metadata: compromised}, RejectionAuthenticatorCompromised},
+		{"compromised accepted", RegistrationPolicy{}, testAAGUID, AttestationResult{Type: AttestationTypeBasic, TrustPath: trustPath, Trusted: true, Metadata: compromised}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = test.policy.Evaluate(test.aaguid, &test.attestation)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var rejection *RegistrationRejection
+			if !errors.As(err, &rejection) || rejection.Reason != test.reason {
+				t.Fatalf("expected rejection %s, got %v", test.reason, err)
+			}
+		})
+	}
+}
+
+func TestRegistrationPolicyWithUnknownMinimumAttestation(t *testing.T) {
+	policy := RegistrationPolicy{MinimumAttestation: "strong"}
+
+	err := policy.validate()
+	if err == nil {
+		t.Fatal("expected unknown attestation type to be rejected")
+	}
+}
+
+func TestRegisterForgedAttestationOfAllowedAuthenticator(t *testing.T) {
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.RegistrationPolicy.Default.AllowedAAGUIDs = []string{FormatAAGUID(testAAGUID)}
+	})
+	authenticator := newTestAuthenticator(t)
+	authenticator.aaguid = testAAGUID
+	attestationKey := newTestKey(t)
+	forged := newTestCertificate(t, packedAttestationSubject, false, attestationKey, nil, nil)
+
+	options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, packedAttestation(t, attestationKey, forged))
+	_, err = webauthn.FinishRegister(request)
+
+	var rejection *RegistrationRejection
+	if !errors.As(err, &rejection) || rejection.Reason != RejectionAAGUIDNotVerified {
+		t.Fatalf("expected rejection %s, got %v", RejectionAAGUIDNotVerified, err)
+	}
+}
+
+func TestRegisterAttestationOfAllowedAuthenticator(t *testing.T) {
+	rootKey := newTestKey(t)
+	root := newTestCertificate(t, pkix.Name{CommonName: "Test Attestation Root"}, true, rootKey, nil, nil)
+	attestationKey := newTestKey(t)
+	attestationCertificate := newTestCertificate(t, packedAttestationSubject, false, attestationKey, root, rootKey)
+
+	webauthn := newTestMetadataWebAuthn(t, root)
+	webauthn.registrationPolicy.Default.AllowedAAGUIDs = []string{FormatAAGUID(testAAGUID)}
+	authenticator := newTestAuthenticator(t)
+	authenticator.aaguid = testAAGUID
+
+	registerTestUser(t, webauthn, authenticator, packedAttestation(t, attestationKey, attestationCertificate))
+}
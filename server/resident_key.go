@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+// ResidentKeyRequirement tells whether the authenticator should create a discoverable credential, which
+// can be used to log in without entering a user name.
+// See https://w3c.github.io/webauthn/#enum-residentKeyRequirement
+type ResidentKeyRequirement string
+
+const (
+	ResidentKeyDiscouraged ResidentKeyRequirement = "discouraged"
+	ResidentKeyPreferred   ResidentKeyRequirement = "preferred"
+	ResidentKeyRequired    ResidentKeyRequirement = "required"
+)
+
+func (requirement *ResidentKeyRequirement) validate() error {
+	switch *requirement {
+	case "":
+		*requirement = ResidentKeyDiscouraged
+	case ResidentKeyDiscouraged, ResidentKeyPreferred, ResidentKeyRequired:
+	default:
+		return fmt.Errorf("Unknown resident key requirement '%s'", *requirement)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrRPIDMismatch the effective domain of the origin is neither the RP ID nor one of its subdomains
+var ErrRPIDMismatch = errors.New("Origin is not within the RP ID")
+
+// validate checks that the RP ID is a domain credentials can be scoped to. Public suffixes like "com" or
+// "github.io" are rejected, as credentials for them would be shared with every site registered below them.
+// See https://w3c.github.io/webauthn/#rp-id
+func (rp *RelyingParty) validate() error {
+	id := strings.ToLower(rp.Id)
+	if id == "" {
+		return errors.New("No RP ID configured")
+	}
+
+	if net.ParseIP(id) != nil {
+		return fmt.Errorf("RP ID '%s' must be a domain, not an IP address", rp.Id)
+	}
+
+	// Unlisted single labels like "localhost" are their own public suffix, but are fine for local development
+	suffix, icann := publicsuffix.PublicSuffix(id)
+	if suffix == id && (icann || strings.Contains(id, ".")) {
+		return fmt.Errorf("RP ID '%s' is a public suffix", rp.Id)
+	}
+
+	rp.Id = id
+	return nil
+}
+
+// VerifyOrigin checks that the effective domain of a web origin equals the RP ID or is a subdomain of it.
+// Origins of native apps have no domain and are only checked against the allowed origins.
+func (rp *RelyingParty) VerifyOrigin(origin string) error {
+	if strings.HasPrefix(origin, androidOriginPrefix) || strings.HasPrefix(origin, iosOriginPrefix) {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("%w; got '%s'", ErrInvalidOrigin, origin)
+	}
+
+	domain := strings.ToLower(parsed.Hostname())
+	if domain != rp.Id && !strings.HasSuffix(domain, "."+rp.Id) {
+		return fmt.Errorf("%w; got '%s' for RP ID '%s'", ErrRPIDMismatch, origin, rp.Id)
+	}
+	return nil
+}
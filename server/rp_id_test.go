@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublicSuffixIsRejectedAsRPID(t *testing.T) {
+	for _, id := range []string{"com", "co.uk", "github.io", "127.0.0.1"} {
+		rp := &RelyingParty{Id: id}
+		if rp.validate() == nil {
+			t.Fatalf("expected RP ID '%s' to be rejected", id)
+		}
+	}
+
+	for _, id := range []string{"example.com", "example.co.uk", "localhost"} {
+		rp := &RelyingParty{Id: id}
+		err := rp.validate()
+		if err != nil {
+			t.Fatalf("expected RP ID '%s' to be allowed, got %v", id, err)
+		}
+	}
+}
+
+func TestOriginMustBeWithinRPID(t *testing.T) {
+	rp := &RelyingParty{Id: "example.com"}
+
+	for _, origin := range []string{"https://example.com", "https://login.example.com", "https://app.example.com:8443", "android:apk-key-hash:abc"} {
+		err := rp.VerifyOrigin(origin)
+		if err != nil {
+			t.Fatalf("expected '%s' to be allowed, got %v", origin, err)
+		}
+	}
+
+	for _, origin := range []string{"https://example.com.evil.com", "https://notexample.com", "https://com"} {
+		err := rp.VerifyOrigin(origin)
+		if !errors.Is(err, ErrRPIDMismatch) {
+			t.Fatalf("expected '%s' to be rejected, got %v", origin, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CeremonyKind tells which ceremony a challenge was issued for
+type CeremonyKind string
+
+const (
+	// CeremonyRegistration creates a new credential
+	CeremonyRegistration CeremonyKind = "registration"
+	// CeremonyAuthentication asserts an existing credential
+	CeremonyAuthentication CeremonyKind = "authentication"
+	// CeremonyAddCredential creates an additional credential for an authenticated user
+	CeremonyAddCredential CeremonyKind = "addCredential"
+)
+
+// ErrCeremonyMismatch the challenge was issued for a different ceremony than the one it is used in
+var ErrCeremonyMismatch = errors.New("Challenge was issued for a different ceremony")
+
+// ErrUnrequestedExtension the client or authenticator returned the output of an extension that was not requested
+var ErrUnrequestedExtension = errors.New("Extension output was not requested")
+
+// UserVerificationRequirement tells whether the authenticator has to verify the user, e.g. by biometrics or a PIN.
+// See https://w3c.github.io/webauthn/#enum-userVerificationRequirement
+type UserVerificationRequirement string
+
+const (
+	UserVerificationRequired    UserVerificationRequirement = "required"
+	UserVerificationPreferred   UserVerificationRequirement = "preferred"
+	UserVerificationDiscouraged UserVerificationRequirement = "discouraged"
+)
+
+// SessionData is the state of a ceremony the server remembers between sending the options to the client
+// and verifying the response of the authenticator.
+type SessionData struct {
+	Kind      CeremonyKind `json:"kind"`
+	Challenge []byte       `json:"challenge"`
+	// Handle of the user the ceremony was started for
+	UserHandle []byte `json:"userHandle"`
+	// Name and display name of the user; only set during registration as the user is not stored yet
+	UserName        string `json:"userName,omitempty"`
+	UserDisplayName string `json:"userDisplayName,omitempty"`
+	// Credentials the user may authenticate with; any credential of the user is allowed if empty
+	AllowedCredentialIds [][]byte                    `json:"allowedCredentialIds"`
+	UserVerification     UserVerificationRequirement `json:"userVerification"`
+	// Extensions requested from the client, by extension identifier
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+	IssuedAt   time.Time              `json:"issuedAt"`
+	Expires    time.Time              `json:"expires"`
+}
+
+// Verify checks that the session belongs to the given ceremony and has not expired.
+func (session *SessionData) Verify(kind CeremonyKind, now time.Time) error {
+	if session.Kind != kind {
+		return fmt.Errorf("%w: expected '%s', found '%s'", ErrCeremonyMismatch, kind, session.Kind)
+	}
+
+	if session.Expired(now) {
+		return ErrChallengeExpired
+	}
+	return nil
+}
+
+// Expired tells whether the session can no longer be used at the given time.
+func (session *SessionData) Expired(now time.Time) bool {
+	return !now.Before(session.Expires)
+}
+
+// VerifyChallenge checks that the client data was created for the challenge of the session.
+func (session *SessionData) VerifyChallenge(clientData ClientData) error {
+	challenge, err := decodeChallenge(clientData)
+	if err != nil || !bytes.Equal([]byte(challenge), session.Challenge) {
+		return ErrChallengeMismatch
+	}
+	return nil
+}
+
+// IsCredentialAllowed tells whether the credential with the given id may be used in the ceremony.
+func (session *SessionData) IsCredentialAllowed(id []byte) bool {
+	if len(session.AllowedCredentialIds) == 0 {
+		return true
+	}
+
+	for _, allowed := range session.AllowedCredentialIds {
+		if bytes.Equal(allowed, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyExtensions checks that the client extension results and the authenticator extension outputs only
+// contain extensions requested in the options of the ceremony.
+func (session *SessionData) VerifyExtensions(clientExtensionResults map[string]interface{}, authData *AuthenticatorData) error {
+	for identifier := range clientExtensionResults {
+		if _, ok := session.Extensions[identifier]; !ok {
+			return fmt.Errorf("%w: '%s'", ErrUnrequestedExtension, identifier)
+		}
+	}
+
+	identifiers, err := authData.ExtensionIdentifiers()
+	if err != nil {
+		return err
+	}
+	for _, identifier := range identifiers {
+		if _, ok := session.Extensions[identifier]; !ok {
+			return fmt.Errorf("%w: '%s'", ErrUnrequestedExtension, identifier)
+		}
+	}
+	return nil
+}
+
+// UserVerificationRequired tells whether the UV flag has to be set by the authenticator.
+func (session *SessionData) UserVerificationRequired() bool {
+	return session.UserVerification == UserVerificationRequired
+}
+
+func (requirement *UserVerificationRequirement) validate() error {
+	switch *requirement {
+	case "":
+		*requirement = UserVerificationPreferred
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	default:
+		return fmt.Errorf("Unknown user verification requirement '%s'", *requirement)
+	}
+	return nil
+}
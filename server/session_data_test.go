@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestSessionOfOtherCeremonyIsRejected(t *testing.T) {
+	session := &SessionData{Kind: CeremonyAuthentication, Expires: time.Now().Add(time.Minute)}
+
+	err := session.Verify(CeremonyRegistration, time.Now())
+	if !errors.Is(err, ErrCeremonyMismatch) {
+		t.Fatalf("expected ErrCeremonyMismatch, got %v", err)
+	}
+
+	err = session.Verify(CeremonyAuthentication, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionVerifyExtensions(t *testing.T) {
+	credProtect, err := cbor.Marshal(map[string]interface{}{"credProtect": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                   string
+		requested              map[string]interface{}
+		clientExtensionResults map[string]interface{}
+		authenticatorOutputs   []byte
+		wantErr                bool
+	}{
+		{"no extensions", nil, nil, nil, false},
+		{"requested client extension", map[string]interface{}{"credProps": true}, map[string]interface{}{"credProps": map[string]interface{}{"rk": true}}, nil, false},
+		{"requested extension without output", map[string]interface{}{"credProps": true}, nil, nil, false},
+		{"unrequested client extension", nil, map[string]interface{}{"credProps": map[string]interface{}{"rk": true}}, nil, true},
+		{"other client extension", map[string]interface{}{"credProps": true}, map[string]interface{}{"appid": true}, nil, true},
+		{"requested authenticator extension", map[string]interface{}{"credProtect": 2}, nil, credProtect, false},
+		{"unrequested authenticator extension", map[string]interface{}{"credProps": true}, nil, credProtect, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := &SessionData{Extensions: test.requested}
+			err := session.VerifyExtensions(test.clientExtensionResults, &AuthenticatorData{ExtData: test.authenticatorOutputs})
+			if test.wantErr && !errors.Is(err, ErrUnrequestedExtension) {
+				t.Fatalf("expected ErrUnrequestedExtension, got %v", err)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSessionVerifyExtensionsWithMalformedAuthenticatorOutputs(t *testing.T) {
+	session := &SessionData{}
+	err := session.VerifyExtensions(nil, &AuthenticatorData{ExtData: []byte{0xff}})
+	if err == nil {
+		t.Fatal("expected malformed authenticator extension outputs to be rejected")
+	}
+}
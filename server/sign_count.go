@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SignCountPolicy decides what happens when the signature counter of a credential does not increase,
+// which indicates that the authenticator may have been cloned.
+// See https://w3c.github.io/webauthn/#sctn-sign-counter
+type SignCountPolicy string
+
+const (
+	// SignCountReject fails the login
+	SignCountReject SignCountPolicy = "reject"
+	// SignCountFlag allows the login, but marks the credential as possibly cloned
+	SignCountFlag SignCountPolicy = "flag"
+	// SignCountAudit allows the login and only emits an audit event
+	SignCountAudit SignCountPolicy = "audit"
+)
+
+// ErrSignCountRegression the signature counter did not increase and the policy rejects such logins
+var ErrSignCountRegression = errors.New("Signature counter did not increase; the authenticator may be cloned")
+
+func (policy *SignCountPolicy) validate() error {
+	switch *policy {
+	case "":
+		*policy = SignCountFlag
+	case SignCountReject, SignCountFlag, SignCountAudit:
+	default:
+		return fmt.Errorf("Unknown sign count policy '%s'", *policy)
+	}
+	return nil
+}
+
+// verifySignCount compares the signature counter of an assertion with the stored one and updates the credential.
+// Authenticators that do not implement a counter always report zero and are accepted.
+func (webauthn *WebAuthn) verifySignCount(user *User, credential *Credential, signCount uint32) error {
+	if signCount == 0 && credential.SignCount == 0 {
+		return nil
+	}
+
+	if signCount > credential.SignCount {
+		credential.SignCount = signCount
+		return nil
+	}
+
+	webauthn.auditLogger.Log(AuditEvent{
+		Type:         AuditSignCountRegression,
+		UserHandle:   user.Handle,
+		CredentialId: credential.Id,
+		Message:      fmt.Sprintf("Received sign count %d, but stored sign count is %d", signCount, credential.SignCount),
+	})
+
+	switch webauthn.signCountPolicy {
+	case SignCountReject:
+		return ErrSignCountRegression
+	case SignCountFlag:
+		credential.CloneWarning = true
+	}
+	return nil
+}
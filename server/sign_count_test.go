@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// recordingAuditLogger remembers the logged audit events.
+type recordingAuditLogger struct {
+	events []AuditEvent
+}
+
+func (logger *recordingAuditLogger) Log(event AuditEvent) {
+	logger.events = append(logger.events, event)
+}
+
+func TestVerifySignCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     uint32
+		received   uint32
+		regression bool
+	}{
+		{"increased", 5, 6, false},
+		{"always zero", 0, 0, false},
+		{"first counter", 0, 1, false},
+		{"equal", 5, 5, true},
+		{"backwards", 5, 3, true},
+		{"reset to zero", 5, 0, true},
+	}
+
+	for _, policy := range []SignCountPolicy{SignCountReject, SignCountFlag, SignCountAudit} {
+		for _, test := range tests {
+			t.Run(string(policy)+"/"+test.name, func(t *testing.T) {
+				logger := &recordingAuditLogger{}
+				webauthn := newTestWebAuthn(t, func(config *Config) {
+					config.SignCountPolicy = policy
+				})
+				webauthn.UseAuditLogger(logger)
+
+				user := &User{Handle: []byte("handle"), Identifier: "alice@example.com"}
+				credential := &Credential{Id: []byte("credential"), SignCount: test.stored}
+				err := webauthn.verifySignCount(user, credential, test.received)
+
+				if !test.regression {
+					if err != nil || len(logger.events) != 0 || credential.CloneWarning {
+						t.Fatalf("expected login without regression, got error %v, %d events, clone warning %v", err, len(logger.events), credential.CloneWarning)
+					}
+					if credential.SignCount != test.received {
+						t.Fatalf("expected stored sign count %d, got %d", test.received, credential.SignCount)
+					}
+					return
+				}
+
+				if len(logger.events) != 1 || logger.events[0].Type != AuditSignCountRegression {
+					t.Fatalf("expected a sign count regression event, got %+v", logger.events)
+				}
+				if policy == SignCountReject && !errors.Is(err, ErrSignCountRegression) {
+					t.Fatalf("expected ErrSignCountRegression, got %v", err)
+				}
+				if policy != SignCountReject && err != nil {
+					t.Fatal(err)
+				}
+				if credential.CloneWarning != (policy == SignCountFlag) {
+					t.Fatalf("expected clone warning only with the flag policy, got %v", credential.CloneWarning)
+				}
+				if credential.SignCount != test.stored {
+					t.Fatalf("expected sign count %d to be kept, got %d", test.stored, credential.SignCount)
+				}
+			})
+		}
+	}
+}
+
+func TestSignCountAuditEventDoesNotContainIdentifier(t *testing.T) {
+	logger := &recordingAuditLogger{}
+	webauthn := newTestWebAuthn(t, nil)
+	webauthn.UseAuditLogger(logger)
+
+	user := &User{Handle: []byte("handle"), Identifier: "alice@example.com"}
+	credential := &Credential{Id: []byte("credential"), SignCount: 5}
+	err := webauthn.verifySignCount(user, credential, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := logger.events[0]
+	if !bytes.Equal(event.UserHandle, user.Handle) || !bytes.Equal(event.CredentialId, credential.Id) {
+		t.Fatalf("expected event of the user handle and credential, got %+v", event)
+	}
+	if bytes.Contains([]byte(event.Message), []byte(user.Identifier)) {
+		t.Fatal("expected the identifier not to be logged")
+	}
+}
+
+func TestLoginRequestExposesCloneWarning(t *testing.T) {
+	router, webauthn := newTestRouter(t)
+	authenticator := newTestAuthenticator(t)
+	registerTestUserRequest(t, router, "alice", authenticator)
+	user, err := webauthn.userRepo.FindByIdentifier("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The authenticator reports the same counter as at registration, as a clone would
+	authenticator.counter--
+	var options LoginResponse
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate", "", AuthenticateRequest{Identifier: "alice"}), http.StatusOK, &options)
+
+	var result CeremonyResultResponse
+	body := authenticator.loginBody(options.Challenge, FlagUserPresent, user.Handle)
+	decodeTestResponse(t, postTestRequest(t, router, "/authenticate/login", "", body), http.StatusOK, &result)
+	if !result.Credential.CloneWarning {
+		t.Fatal("expected the clone warning to be exposed")
+	}
+}
@@ -10,10 +10,28 @@ func ConnectDB() (*sql.DB, error) {
 		return nil, err
 	}
 
-	runMigration(
+	err = migrateDB(db)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateDB brings the schema of the database up to date.
+func migrateDB(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS migration (
+			identifier VARCHAR NOT NULL PRIMARY KEY
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
 		db,
 		`
-		CREATE TABLE credential (
+		CREATE TABLE IF NOT EXISTS credential (
 			id VARCHAR NOT NULL PRIMARY KEY,
 			public_key BLOB NOT NULL,
 			type VARCHAR,
@@ -23,14 +41,184 @@ func ConnectDB() (*sql.DB, error) {
 		`,
 		"masterMigration",
 	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`ALTER TABLE credential ADD COLUMN attestation_type VARCHAR NOT NULL DEFAULT 'none'`,
+		"credentialAttestationType",
+	)
+	if err != nil {
+		return err
+	}
 
-	return db, nil
+	err = runMigration(
+		db,
+		`ALTER TABLE credential ADD COLUMN sign_count INTEGER NOT NULL DEFAULT 0`,
+		"credentialSignCount",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`ALTER TABLE credential ADD COLUMN clone_warning BOOLEAN NOT NULL DEFAULT FALSE`,
+		"credentialCloneWarning",
+	)
+	if err != nil {
+		return err
+	}
+
+	// The backup eligibility of existing credentials is unknown until their next login
+	err = runMigration(
+		db,
+		`ALTER TABLE credential ADD COLUMN backup_eligible BOOLEAN`,
+		"credentialBackupEligible",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`ALTER TABLE credential ADD COLUMN backup_state BOOLEAN NOT NULL DEFAULT FALSE`,
+		"credentialBackupState",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`
+		CREATE TABLE IF NOT EXISTS challenge (
+			value BLOB NOT NULL PRIMARY KEY,
+			kind VARCHAR NOT NULL,
+			response BLOB NOT NULL,
+			issued_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		)
+		`,
+		"challenge",
+	)
+	if err != nil {
+		return err
+	}
+
+	// Outstanding challenges are dropped, their ceremonies can simply be restarted
+	err = runMigration(
+		db,
+		`
+		DROP TABLE challenge;
+		CREATE TABLE challenge (
+			value BLOB NOT NULL PRIMARY KEY,
+			session BLOB NOT NULL,
+			expires_at INTEGER NOT NULL
+		)
+		`,
+		"challengeSessionData",
+	)
+	if err != nil {
+		return err
+	}
+
+	// Existing users keep their user name as handle, as their authenticators were registered with it as user.id;
+	// their credentials are linked to the handle instead of the user name
+	err = runMigration(
+		db,
+		`
+		CREATE TABLE users (
+			handle BLOB NOT NULL PRIMARY KEY,
+			name VARCHAR NOT NULL UNIQUE,
+			display_name VARCHAR NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT INTO users (handle, name, display_name, created_at, updated_at)
+			SELECT CAST(user_id AS BLOB), user_id, user_id, unixepoch() * 1000, unixepoch() * 1000
+			FROM credential GROUP BY user_id;
+		ALTER TABLE credential ADD COLUMN user_handle BLOB REFERENCES users (handle);
+		UPDATE credential SET user_handle = (SELECT handle FROM users WHERE name = credential.user_id);
+		ALTER TABLE credential DROP COLUMN user_id;
+		`,
+		"users",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`
+		CREATE TABLE IF NOT EXISTS conditional_challenge (
+			value BLOB NOT NULL PRIMARY KEY,
+			session BLOB NOT NULL,
+			expires_at INTEGER NOT NULL
+		)
+		`,
+		"conditionalChallenge",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = runMigration(
+		db,
+		`
+		CREATE TABLE IF NOT EXISTS access_key (
+			hash BLOB NOT NULL PRIMARY KEY,
+			user_handle BLOB NOT NULL REFERENCES users (handle),
+			expires_at INTEGER NOT NULL
+		)
+		`,
+		"accessKey",
+	)
+	if err != nil {
+		return err
+	}
+
+	// The table also holds the challenges of discoverable logins without conditional mediation
+	err = runMigration(
+		db,
+		`ALTER TABLE conditional_challenge RENAME TO usernameless_challenge`,
+		"usernamelessChallenge",
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
+// runMigration executes the given statement once; applied migrations are remembered by their identifier.
 func runMigration(db *sql.DB, sql string, identifier string) error {
-	_, err := db.Exec(sql)
+	var applied int
+	err := db.QueryRow("SELECT COUNT(*) FROM migration WHERE identifier = ?", identifier).Scan(&applied)
 	if err != nil {
 		return err
 	}
-	return nil
+	if applied > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO migration (identifier) VALUES (?)", identifier)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
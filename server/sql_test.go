@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// newTestDB opens an in-memory database; a single connection keeps all queries on the same database.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateLegacyUsers(t *testing.T) {
+	db := newTestDB(t)
+	authenticator := newTestAuthenticator(t)
+
+	// The schema before users had handles, where credentials referenced the user name
+	_, err := db.Exec(`
+		CREATE TABLE migration (identifier VARCHAR NOT NULL PRIMARY KEY);
+		CREATE TABLE credential (
+			id VARCHAR NOT NULL PRIMARY KEY,
+			public_key BLOB NOT NULL,
+			type VARCHAR,
+			transports VARCHAR,
+			user_id VARCHAR NOT NULL
+		);
+		INSERT INTO migration (identifier) VALUES ('masterMigration');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(
+		"INSERT INTO credential (id, public_key, type, transports, user_id) VALUES (?, ?, 'public-key', 'platform', 'alice')",
+		authenticator.credentialId,
+		authenticator.coseKey(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &SqliteUserRepository{db: db}
+	user, err := repo.FindByHandle([]byte("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Identifier != "alice" || len(user.Credentials) != 1 {
+		t.Fatalf("expected user alice with one credential, got %+v", user)
+	}
+	if user.Credentials[0].BackupEligible != nil {
+		t.Fatal("expected backup eligibility of a legacy credential to be unknown")
+	}
+
+	// Authenticators of legacy users return the user name they were registered with as user handle
+	webauthn := newTestWebAuthn(t, nil)
+	_, err = loginTestUser(t, webauthn, authenticator, user, FlagUserPresent, []byte("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateChallengesOfRawOptions(t *testing.T) {
+	db := newTestDB(t)
+
+	// The challenge table before typed session data, with an outstanding challenge
+	_, err := db.Exec(`
+		CREATE TABLE migration (identifier VARCHAR NOT NULL PRIMARY KEY);
+		CREATE TABLE challenge (
+			value BLOB NOT NULL PRIMARY KEY,
+			kind VARCHAR NOT NULL,
+			response BLOB NOT NULL,
+			issued_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+		INSERT INTO migration (identifier) VALUES ('challenge');
+		INSERT INTO challenge (value, kind, response, issued_at, expires_at) VALUES (x'00', 'login', '{}', 0, 0);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewSqliteChallengeRepository(db, 10)
+	err = repo.Create(newTestChallenge("challenge", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := repo.FindAndDeleteByValue("challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Session.Kind != CeremonyAuthentication {
+		t.Fatalf("expected the stored session, got %+v", challenge.Session)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SqliteAccessKeyRepository stores access keys in the database, so they stay valid across restarts and
+// can be used with any server instance. Only the hash of an access key is stored.
+type SqliteAccessKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteAccessKeyRepository(db *sql.DB) *SqliteAccessKeyRepository {
+	return &SqliteAccessKeyRepository{db: db}
+}
+
+func (repo *SqliteAccessKeyRepository) FindByValue(value string) (*AccessKey, error) {
+	hash := sha256.Sum256([]byte(value))
+	accessKey := &AccessKey{Value: value}
+	var expires int64
+	err := repo.db.QueryRow("SELECT user_handle, expires_at FROM access_key WHERE hash = ?", hash[:]).Scan(&accessKey.UserHandle, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAccessKey
+	}
+	if err != nil {
+		fmt.Println(err)
+		return nil, ErrInvalidAccessKey
+	}
+	accessKey.Expires = time.UnixMilli(expires)
+
+	if !time.Now().Before(accessKey.Expires) {
+		repo.db.Exec("DELETE FROM access_key WHERE hash = ?", hash[:])
+		return nil, ErrInvalidAccessKey
+	}
+	return accessKey, nil
+}
+
+// Create stores the access key and removes expired ones.
+func (repo *SqliteAccessKeyRepository) Create(accessKey *AccessKey) error {
+	_, err := repo.db.Exec("DELETE FROM access_key WHERE expires_at <= ?", time.Now().UnixMilli())
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("Could not delete expired access keys")
+	}
+
+	hash := sha256.Sum256([]byte(accessKey.Value))
+	_, err = repo.db.Exec(
+		"INSERT INTO access_key (hash, user_handle, expires_at) VALUES (?, ?, ?)",
+		hash[:],
+		accessKey.UserHandle,
+		accessKey.Expires.UnixMilli(),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("Could not create access key")
+	}
+	return nil
+}
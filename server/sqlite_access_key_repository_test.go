@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func newTestSqliteAccessKeyRepository(t *testing.T) *SqliteAccessKeyRepository {
+	t.Helper()
+
+	db := newTestDB(t)
+	err := migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSqliteAccessKeyRepository(db)
+}
+
+func TestSqliteAccessKeyRepository(t *testing.T) {
+	repo := newTestSqliteAccessKeyRepository(t)
+	accessKey, err := NewAccessKey(&User{Handle: []byte("alice")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Create(accessKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another server instance using the same database
+	found, err := NewSqliteAccessKeyRepository(repo.db).FindByValue(accessKey.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found.UserHandle, accessKey.UserHandle) || found.Expires.UnixMilli() != accessKey.Expires.UnixMilli() {
+		t.Fatalf("expected the stored access key, got %+v", found)
+	}
+
+	for _, value := range []string{"unknown", ""} {
+		_, err = repo.FindByValue(value)
+		if err != ErrInvalidAccessKey {
+			t.Fatalf("expected ErrInvalidAccessKey for '%s', got %v", value, err)
+		}
+	}
+}
+
+func TestSqliteAccessKeyRepositoryDoesNotStoreValue(t *testing.T) {
+	repo := newTestSqliteAccessKeyRepository(t)
+	accessKey := &AccessKey{Value: "secret", UserHandle: []byte("alice"), Expires: time.Now().Add(time.Minute)}
+	err := repo.Create(accessKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hash []byte
+	err = repo.db.QueryRow("SELECT hash FROM access_key").Scan(&hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(hash, []byte(accessKey.Value)) {
+		t.Fatal("expected only the hash of the access key to be stored")
+	}
+}
+
+func TestSqliteExpiredAccessKeyIsRejected(t *testing.T) {
+	repo := newTestSqliteAccessKeyRepository(t)
+	err := repo.Create(&AccessKey{Value: "expired", UserHandle: []byte("alice"), Expires: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.FindByValue("expired")
+	if err != ErrInvalidAccessKey {
+		t.Fatalf("expected ErrInvalidAccessKey, got %v", err)
+	}
+}
+
+func TestSqliteAccessKeyRepositoryRemovesExpiredKeys(t *testing.T) {
+	repo := newTestSqliteAccessKeyRepository(t)
+	repo.Create(&AccessKey{Value: "expired", UserHandle: []byte("alice"), Expires: time.Now().Add(-time.Second)})
+	repo.Create(&AccessKey{Value: "valid", UserHandle: []byte("alice"), Expires: time.Now().Add(time.Minute)})
+
+	var count int
+	err := repo.db.QueryRow("SELECT COUNT(*) FROM access_key").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected only the valid access key to be kept, got %d", count)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SqliteChallengeRepository stores challenges in the database, so ceremonies survive restarts and
+// can be finished on a different server instance than the one that started them.
+type SqliteChallengeRepository struct {
+	db             *sql.DB
+	table          string
+	maxOutstanding int
+}
+
+// NewSqliteChallengeRepository creates a repository holding at most maxOutstanding challenges.
+func NewSqliteChallengeRepository(db *sql.DB, maxOutstanding int) *SqliteChallengeRepository {
+	return &SqliteChallengeRepository{
+		db:             db,
+		table:          "challenge",
+		maxOutstanding: maxOutstanding,
+	}
+}
+
+// NewSqliteUsernamelessChallengeRepository creates a repository holding at most maxOutstanding challenges
+// for logins without an identifier. They are kept in their own table, so they are counted separately.
+func NewSqliteUsernamelessChallengeRepository(db *sql.DB, maxOutstanding int) *SqliteChallengeRepository {
+	return &SqliteChallengeRepository{
+		db:             db,
+		table:          "usernameless_challenge",
+		maxOutstanding: maxOutstanding,
+	}
+}
+
+func (repo *SqliteChallengeRepository) FindByValue(value string) (*Challenge, error) {
+	row := repo.db.QueryRow(fmt.Sprintf("SELECT session FROM %s WHERE value = ?", repo.table), []byte(value))
+	challenge, err := scanChallenge(value, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.Expired(time.Now()) {
+		repo.DeleteByValue(value)
+		return nil, ErrChallengeExpired
+	}
+	return challenge, nil
+}
+
+func (repo *SqliteChallengeRepository) Create(challenge *Challenge) error {
+	session, err := json.Marshal(challenge.Session)
+	if err != nil {
+		return err
+	}
+
+	// Counting and inserting in a single statement keeps the limit intact with concurrent requests
+	result, err := repo.db.Exec(
+		fmt.Sprintf(
+			`INSERT INTO %[1]s (value, session, expires_at)
+			SELECT ?, ?, ?
+			WHERE (SELECT COUNT(*) FROM %[1]s WHERE expires_at > ?) < ?`,
+			repo.table,
+		),
+		[]byte(challenge.Value),
+		session,
+		challenge.Session.Expires.UnixMilli(),
+		time.Now().UnixMilli(),
+		repo.maxOutstanding,
+	)
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("Could not create challenge")
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrTooManyChallenges
+	}
+	return nil
+}
+
+func (repo *SqliteChallengeRepository) DeleteByValue(value string) error {
+	_, err := repo.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE value = ?", repo.table), []byte(value))
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("Could not delete challenge")
+	}
+	return nil
+}
+
+func (repo *SqliteChallengeRepository) FindAndDeleteByValue(value string) (*Challenge, error) {
+	row := repo.db.QueryRow(fmt.Sprintf("DELETE FROM %s WHERE value = ? RETURNING session", repo.table), []byte(value))
+	challenge, err := scanChallenge(value, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.Expired(time.Now()) {
+		return nil, ErrChallengeExpired
+	}
+	return challenge, nil
+}
+
+func (repo *SqliteChallengeRepository) DeleteExpired(now time.Time) error {
+	_, err := repo.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", repo.table), now.UnixMilli())
+	if err != nil {
+		fmt.Println(err)
+		return errors.New("Could not delete expired challenges")
+	}
+	return nil
+}
+
+func scanChallenge(value string, row *sql.Row) (*Challenge, error) {
+	var data []byte
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &SessionData{}
+	err = json.Unmarshal(data, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Challenge{
+		Value:   value,
+		Session: session,
+	}, nil
+}
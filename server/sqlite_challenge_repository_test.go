@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestSqliteChallengeRepository(t *testing.T, maxOutstanding int) *SqliteChallengeRepository {
+	t.Helper()
+
+	db := newTestDB(t)
+	err := migrateDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSqliteChallengeRepository(db, maxOutstanding)
+}
+
+func TestSqliteChallengeCanOnlyBeConsumedOnce(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 10)
+	err := repo.Create(newTestChallenge("challenge", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var consumed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.FindAndDeleteByValue("challenge")
+			if err == nil {
+				atomic.AddInt32(&consumed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if consumed != 1 {
+		t.Fatalf("expected challenge to be consumed once, got %d", consumed)
+	}
+}
+
+func TestSqliteChallengeKeepsSession(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 10)
+	challenge := newTestChallenge("challenge", time.Now())
+	challenge.Session.UserHandle = []byte("handle")
+	challenge.Session.UserVerification = UserVerificationRequired
+	err := repo.Create(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.FindByValue("challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(found.Session.UserHandle) != "handle" || found.Session.UserVerification != UserVerificationRequired {
+		t.Fatalf("expected session to be stored, got %+v", found.Session)
+	}
+}
+
+func TestSqliteExpiredChallengeIsRejected(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 10)
+	repo.Create(newTestChallenge("consumed", time.Now().Add(-2*time.Minute)))
+	repo.Create(newTestChallenge("found", time.Now().Add(-2*time.Minute)))
+
+	_, err := repo.FindAndDeleteByValue("consumed")
+	if err != ErrChallengeExpired {
+		t.Fatalf("expected ErrChallengeExpired, got %v", err)
+	}
+
+	_, err = repo.FindByValue("found")
+	if err != ErrChallengeExpired {
+		t.Fatalf("expected ErrChallengeExpired, got %v", err)
+	}
+}
+
+func TestSqliteOutstandingChallengesAreBounded(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 1)
+	err := repo.Create(newTestChallenge("first", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Create(newTestChallenge("second", time.Now()))
+	if err != ErrTooManyChallenges {
+		t.Fatalf("expected ErrTooManyChallenges, got %v", err)
+	}
+}
+
+func TestSqliteOutstandingChallengesAreBoundedConcurrently(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 10)
+
+	var created int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.Create(newTestChallenge(fmt.Sprintf("challenge-%d", i), time.Now()))
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 10 {
+		t.Fatalf("expected 10 challenges to be created, got %d", created)
+	}
+}
+
+func TestSqliteExpiredChallengesDoNotCountTowardsLimit(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 1)
+	repo.Create(newTestChallenge("expired", time.Now().Add(-2*time.Minute)))
+
+	err := repo.Create(newTestChallenge("current", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSqliteDeleteExpiredChallenges(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 10)
+	repo.Create(newTestChallenge("expired", time.Now().Add(-2*time.Minute)))
+	repo.Create(newTestChallenge("current", time.Now()))
+
+	err := repo.DeleteExpired(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining int
+	err = repo.db.QueryRow("SELECT COUNT(*) FROM challenge").Scan(&remaining)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Fatalf("expected only the current challenge to remain, got %d", remaining)
+	}
+
+	_, err = repo.FindAndDeleteByValue("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSqliteUsernamelessChallengesAreBoundedSeparately(t *testing.T) {
+	repo := newTestSqliteChallengeRepository(t, 1)
+	usernamelessRepo := NewSqliteUsernamelessChallengeRepository(repo.db, 1)
+
+	err := usernamelessRepo.Create(newTestChallenge("usernameless", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = usernamelessRepo.Create(newTestChallenge("usernameless-2", time.Now()))
+	if err != ErrTooManyChallenges {
+		t.Fatalf("expected ErrTooManyChallenges, got %v", err)
+	}
+
+	err = repo.Create(newTestChallenge("challenge", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.FindAndDeleteByValue("usernameless")
+	if err != ErrChallengeNotFound {
+		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
+	}
+	_, err = usernamelessRepo.FindAndDeleteByValue("usernameless")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
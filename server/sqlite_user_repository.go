@@ -2,8 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/fxamacker/cbor"
 )
@@ -13,11 +15,53 @@ type SqliteUserRepository struct {
 }
 
 func (repo *SqliteUserRepository) FindByIdentifier(identifier string) (*User, error) {
-	rows, err := repo.db.Query("SELECT id, public_key, type, transports FROM credential WHERE user_id = ?", identifier)
+	row := repo.db.QueryRow("SELECT handle, name, display_name, created_at, updated_at FROM users WHERE name = ?", identifier)
+	user, err := repo.scanUser(row)
 	if err != nil {
 		fmt.Println(err)
 		return nil, fmt.Errorf("No user with identifier '%s' found", identifier)
 	}
+	return user, nil
+}
+
+func (repo *SqliteUserRepository) FindByHandle(handle []byte) (*User, error) {
+	row := repo.db.QueryRow("SELECT handle, name, display_name, created_at, updated_at FROM users WHERE handle = ?", handle)
+	user, err := repo.scanUser(row)
+	if err != nil {
+		fmt.Println(err)
+		return nil, fmt.Errorf("No user with handle '%x' found", handle)
+	}
+	return user, nil
+}
+
+func (repo *SqliteUserRepository) FindByCredentialId(id []byte) (*User, error) {
+	row := repo.db.QueryRow(
+		"SELECT handle, name, display_name, created_at, updated_at FROM users WHERE handle = (SELECT user_handle FROM credential WHERE id = ?)",
+		id,
+	)
+	user, err := repo.scanUser(row)
+	if err != nil {
+		fmt.Println(err)
+		return nil, fmt.Errorf("No user with credential '%x' found", id)
+	}
+	return user, nil
+}
+
+// scanUser reads the user from the row and loads its credentials.
+func (repo *SqliteUserRepository) scanUser(row *sql.Row) (*User, error) {
+	user := &User{}
+	var createdAt, updatedAt int64
+	err := row.Scan(&user.Handle, &user.Identifier, &user.DisplayName, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = time.UnixMilli(createdAt)
+	user.UpdatedAt = time.UnixMilli(updatedAt)
+
+	rows, err := repo.db.Query("SELECT id, public_key, type, transports, attestation_type, sign_count, clone_warning, backup_eligible, backup_state FROM credential WHERE user_handle = ?", user.Handle)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	crendentials := []Credential{}
@@ -25,7 +69,7 @@ func (repo *SqliteUserRepository) FindByIdentifier(identifier string) (*User, er
 		credential := Credential{}
 		publicKey := []byte{}
 		var transports string
-		rows.Scan(&credential.Id, &publicKey, &credential.Type, &transports)
+		rows.Scan(&credential.Id, &publicKey, &credential.Type, &transports, &credential.AttestationType, &credential.SignCount, &credential.CloneWarning, &credential.BackupEligible, &credential.BackupState)
 
 		credential.PublicKey, _ = ParsePublicKey(publicKey)
 		credential.Transports = strings.Split(transports, ",")
@@ -34,32 +78,116 @@ func (repo *SqliteUserRepository) FindByIdentifier(identifier string) (*User, er
 	}
 
 	if len(crendentials) == 0 {
-		return nil, fmt.Errorf("No user with identifier '%s' found", identifier)
-	}
-
-	user := &User{
-		Identifier:  identifier,
-		Credentials: crendentials,
+		return nil, errors.New("User has no credentials")
 	}
+	user.Credentials = crendentials
 
 	return user, nil
 }
 
 func (repo *SqliteUserRepository) Create(user *User) error {
-	publicKey, err := cbor.Marshal(user.Credentials[0].PublicKey, cbor.CTAP2EncOptions())
-	transports := strings.Join(user.Credentials[0].Transports, ",")
+	tx, err := repo.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not insert with identifier '%s'", user.Identifier)
+	}
+	defer tx.Rollback()
 
-	_, err = repo.db.Exec(
-		"INSERT INTO credential (id, public_key, type, transports, user_id) VALUES (?, ?, ?, ?, ?)",
-		user.Credentials[0].Id,
-		publicKey,
-		user.Credentials[0].Type,
-		transports,
+	now := time.Now()
+	_, err = tx.Exec(
+		"INSERT INTO users (handle, name, display_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		user.Handle,
 		user.Identifier,
+		user.DisplayName,
+		now.UnixMilli(),
+		now.UnixMilli(),
 	)
 	if err != nil {
 		fmt.Println(err)
 		return fmt.Errorf("Could not insert with identifier '%s'", user.Identifier)
 	}
+
+	for i := 0; i < len(user.Credentials); i++ {
+		err = insertCredential(tx, user.Handle, &user.Credentials[i])
+		if err != nil {
+			fmt.Println(err)
+			return fmt.Errorf("Could not insert with identifier '%s'", user.Identifier)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not insert with identifier '%s'", user.Identifier)
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+func (repo *SqliteUserRepository) AddCredential(user *User, credential *Credential) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not add credential '%x'", credential.Id)
+	}
+	defer tx.Rollback()
+
+	err = insertCredential(tx, user.Handle, credential)
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not add credential '%x'", credential.Id)
+	}
+
+	_, err = tx.Exec("UPDATE users SET updated_at = ? WHERE handle = ?", time.Now().UnixMilli(), user.Handle)
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not add credential '%x'", credential.Id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not add credential '%x'", credential.Id)
+	}
+	return nil
+}
+
+func insertCredential(tx *sql.Tx, userHandle []byte, credential *Credential) error {
+	publicKey, err := cbor.Marshal(credential.PublicKey, cbor.CTAP2EncOptions())
+	if err != nil {
+		return err
+	}
+	transports := strings.Join(credential.Transports, ",")
+
+	_, err = tx.Exec(
+		"INSERT INTO credential (id, public_key, type, transports, user_handle, attestation_type, sign_count, backup_eligible, backup_state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		credential.Id,
+		publicKey,
+		credential.Type,
+		transports,
+		userHandle,
+		credential.AttestationType,
+		credential.SignCount,
+		credential.BackupEligible,
+		credential.BackupState,
+	)
+	return err
+}
+
+func (repo *SqliteUserRepository) UpdateCredential(credential *Credential) error {
+	_, err := repo.db.Exec(
+		"UPDATE credential SET sign_count = ?, clone_warning = ?, backup_eligible = ?, backup_state = ? WHERE id = ?",
+		credential.SignCount,
+		credential.CloneWarning,
+		credential.BackupEligible,
+		credential.BackupState,
+		credential.Id,
+	)
+	if err != nil {
+		fmt.Println(err)
+		return fmt.Errorf("Could not update credential '%x'", credential.Id)
+	}
 	return nil
 }
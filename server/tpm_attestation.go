@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+type TPMAttestationStatement struct {
+	Version      string   `cbor:"ver"`
+	Algorithm    int      `cbor:"alg"`
+	Certificates [][]byte `cbor:"x5c"`
+	Signature    []byte   `cbor:"sig"`
+	CertInfo     []byte   `cbor:"certInfo"`
+	PubArea      []byte   `cbor:"pubArea"`
+}
+
+// TPM algorithm and structure identifiers from the TPM 2.0 Library, Part 2: Structures
+const (
+	tpmAlgRSA    uint16 = 0x0001
+	tpmAlgSHA1   uint16 = 0x0004
+	tpmAlgSHA256 uint16 = 0x000B
+	tpmAlgSHA384 uint16 = 0x000C
+	tpmAlgSHA512 uint16 = 0x000D
+	tpmAlgNull   uint16 = 0x0010
+	tpmAlgECC    uint16 = 0x0023
+
+	tpmECCNistP256 uint16 = 0x0003
+	tpmECCNistP384 uint16 = 0x0004
+	tpmECCNistP521 uint16 = 0x0005
+
+	tpmGeneratedValue  uint32 = 0xff544347
+	tpmStAttestCertify uint16 = 0x8017
+)
+
+var (
+	oidTPMManufacturer         = asn1.ObjectIdentifier{2, 23, 133, 2, 1}
+	oidTPMModel                = asn1.ObjectIdentifier{2, 23, 133, 2, 2}
+	oidTPMVersion              = asn1.ObjectIdentifier{2, 23, 133, 2, 3}
+	oidTCGKpAIKCertificate     = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+	oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+// TPMAttestationVerifier implements the verification procedure of the tpm attestation statement format.
+// See https://w3c.github.io/webauthn/#sctn-tpm-attestation
+type TPMAttestationVerifier struct{}
+
+func (verifier *TPMAttestationVerifier) Verify(attestationObject *AttestationObject, clientDataHash []byte) (*AttestationResult, error) {
+	var attStmt TPMAttestationStatement
+	err := attestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if attStmt.Version != "2.0" {
+		return nil, fmt.Errorf("TPM attestation version must be '2.0'; got '%s'", attStmt.Version)
+	}
+
+	// Verify that the public key specified by the parameters and unique fields of pubArea is identical
+	// to the credentialPublicKey in the attestedCredentialData in authenticatorData.
+	pubArea, err := parseTPMTPublic(attStmt.PubArea)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := attestationObject.CredentialPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = pubArea.matches(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate that certInfo is valid
+	certInfo, err := parseTPMSAttest(attStmt.CertInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if certInfo.magic != tpmGeneratedValue {
+		return nil, fmt.Errorf("TPM certInfo magic must be TPM_GENERATED_VALUE; got %x", certInfo.magic)
+	}
+
+	if certInfo.attestType != tpmStAttestCertify {
+		return nil, fmt.Errorf("TPM certInfo type must be TPM_ST_ATTEST_CERTIFY; got %x", certInfo.attestType)
+	}
+
+	// Verify that extraData is set to the hash of attToBeSigned using the hash algorithm employed in alg.
+	attToBeSigned := append(append([]byte{}, attestationObject.RawAuthnData...), clientDataHash...)
+	hash := HasherFromCOSEAlg(COSEAlgorithmIdentifier(attStmt.Algorithm))()
+	hash.Write(attToBeSigned)
+	if !bytes.Equal(certInfo.extraData, hash.Sum(nil)) {
+		return nil, errors.New("TPM certInfo extraData does not match the hash of the attested data")
+	}
+
+	// Verify that attested contains a TPMS_CERTIFY_INFO structure whose name field contains a valid
+	// Name for pubArea, as computed using the algorithm in the nameAlg field of pubArea.
+	nameHash, err := tpmHash(pubArea.nameAlg)
+	if err != nil {
+		return nil, err
+	}
+	nameDigest := nameHash.New()
+	nameDigest.Write(attStmt.PubArea)
+	expectedName := binary.BigEndian.AppendUint16(nil, pubArea.nameAlg)
+	expectedName = append(expectedName, nameDigest.Sum(nil)...)
+	if !bytes.Equal(certInfo.attestedName, expectedName) {
+		return nil, errors.New("TPM certInfo attested name does not match pubArea")
+	}
+
+	certificates, err := parseCertificateChain(attStmt.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	aikCertificate := certificates[0]
+
+	err = verifyAttestationSignature(aikCertificate, COSEAlgorithmIdentifier(attStmt.Algorithm), attStmt.CertInfo, attStmt.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyAIKCertificate(aikCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCertificateAAGUID(aikCertificate, attestationObject.AuthnData.AttData.AAGUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationResult{
+		Type:      AttestationTypeAttCA,
+		TrustPath: certificates,
+	}, nil
+}
+
+// verifyAIKCertificate checks the attestation identity key certificate against the TPM attestation requirements.
+// See https://w3c.github.io/webauthn/#sctn-tpm-cert-requirements
+func verifyAIKCertificate(certificate *x509.Certificate) error {
+	if certificate.Version != 3 {
+		return fmt.Errorf("AIK certificate must be version 3; got version %d", certificate.Version)
+	}
+
+	if len(certificate.Subject.Names) != 0 {
+		return errors.New("AIK certificate subject must be empty")
+	}
+
+	manufacturer, model, version, err := parseTPMSubjectAltName(certificate)
+	if err != nil {
+		return err
+	}
+	if manufacturer == "" || model == "" || version == "" {
+		return errors.New("AIK certificate subject alternative name must contain TPM manufacturer, model and version")
+	}
+
+	hasAIKUsage := false
+	for _, usage := range certificate.UnknownExtKeyUsage {
+		if usage.Equal(oidTCGKpAIKCertificate) {
+			hasAIKUsage = true
+		}
+	}
+	if !hasAIKUsage {
+		return errors.New("AIK certificate extended key usage must contain tcg-kp-AIKCertificate")
+	}
+
+	if certificate.IsCA {
+		return errors.New("AIK certificate must not be a CA certificate")
+	}
+
+	return nil
+}
+
+// parseTPMSubjectAltName reads the TPM manufacturer, model and version from the directoryName
+// of the subject alternative name extension. Go's x509 package does not expose directory names.
+func parseTPMSubjectAltName(certificate *x509.Certificate) (manufacturer, model, version string, err error) {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+
+		var generalNames []asn1.RawValue
+		if _, err = asn1.Unmarshal(extension.Value, &generalNames); err != nil {
+			return "", "", "", fmt.Errorf("Could not parse subject alternative name of AIK certificate: %w", err)
+		}
+
+		for _, generalName := range generalNames {
+			// directoryName [4] Name
+			if generalName.Class != asn1.ClassContextSpecific || generalName.Tag != 4 {
+				continue
+			}
+
+			var name pkix.RDNSequence
+			if _, err = asn1.Unmarshal(generalName.Bytes, &name); err != nil {
+				return "", "", "", fmt.Errorf("Could not parse directory name of AIK certificate: %w", err)
+			}
+
+			for _, rdn := range name {
+				for _, attribute := range rdn {
+					value, _ := attribute.Value.(string)
+					switch {
+					case attribute.Type.Equal(oidTPMManufacturer):
+						manufacturer = value
+					case attribute.Type.Equal(oidTPMModel):
+						model = value
+					case attribute.Type.Equal(oidTPMVersion):
+						version = value
+					}
+				}
+			}
+		}
+	}
+	return manufacturer, model, version, nil
+}
+
+// tpmPublic holds the fields of a TPMT_PUBLIC structure needed to compare it to the credential public key.
+type tpmPublic struct {
+	algorithm uint16
+	nameAlg   uint16
+	// RSA parameters
+	exponent uint32
+	modulus  []byte
+	// ECC parameters
+	curveID uint16
+	x       []byte
+	y       []byte
+}
+
+func (pub *tpmPublic) matches(publicKey PublicKey) error {
+	switch key := publicKey.(type) {
+	case *RSAPublicKeyData:
+		if pub.algorithm != tpmAlgRSA {
+			return errors.New("TPM pubArea is not an RSA key, but the credential public key is")
+		}
+
+		exponent := pub.exponent
+		if exponent == 0 {
+			// An exponent of zero indicates the default exponent of 2^16 + 1
+			exponent = 65537
+		}
+		if new(big.Int).SetBytes(key.Exponent).Cmp(big.NewInt(int64(exponent))) != 0 {
+			return errors.New("TPM pubArea exponent does not match the credential public key")
+		}
+
+		if !bytes.Equal(pub.modulus, key.Modulus) {
+			return errors.New("TPM pubArea modulus does not match the credential public key")
+		}
+	case *EC2PublicKeyData:
+		if pub.algorithm != tpmAlgECC {
+			return errors.New("TPM pubArea is not an ECC key, but the credential public key is")
+		}
+
+		curves := map[uint16]int64{tpmECCNistP256: 1, tpmECCNistP384: 2, tpmECCNistP521: 3}
+		curve, ok := curves[pub.curveID]
+		if !ok {
+			return fmt.Errorf("TPM pubArea curve %#04x is not supported", pub.curveID)
+		}
+		if curve != key.Curve {
+			return errors.New("TPM pubArea curve does not match the credential public key")
+		}
+
+		if !bytes.Equal(pub.x, key.XCoord) || !bytes.Equal(pub.y, key.YCoord) {
+			return errors.New("TPM pubArea point does not match the credential public key")
+		}
+	default:
+		return errors.New("Credential public key type is not supported by TPM attestation")
+	}
+	return nil
+}
+
+// tpmAttest holds the fields of a TPMS_ATTEST structure needed for attestation verification.
+type tpmAttest struct {
+	magic        uint32
+	attestType   uint16
+	extraData    []byte
+	attestedName []byte
+}
+
+// tpmReader reads big endian TPM structures from a byte slice and remembers the first error.
+type tpmReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *tpmReader) next(n int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if len(reader.data) < n {
+		reader.err = errors.New("TPM structure is too short")
+		return nil
+	}
+	value := reader.data[:n]
+	reader.data = reader.data[n:]
+	return value
+}
+
+func (reader *tpmReader) uint16() uint16 {
+	value := reader.next(2)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(value)
+}
+
+func (reader *tpmReader) uint32() uint32 {
+	value := reader.next(4)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(value)
+}
+
+// sized reads a TPM2B structure, that is a two byte size followed by that many bytes.
+func (reader *tpmReader) sized() []byte {
+	return reader.next(int(reader.uint16()))
+}
+
+// parseTPMTPublic parses the TPMT_PUBLIC structure of pubArea.
+func parseTPMTPublic(data []byte) (*tpmPublic, error) {
+	reader := &tpmReader{data: data}
+	pub := &tpmPublic{}
+
+	pub.algorithm = reader.uint16()
+	pub.nameAlg = reader.uint16()
+	reader.uint32() // objectAttributes
+	reader.sized()  // authPolicy
+
+	// symmetric: TPMT_SYM_DEF_OBJECT
+	if reader.uint16() != tpmAlgNull {
+		reader.uint16() // keyBits
+		reader.uint16() // mode
+	}
+
+	// scheme: TPMT_RSA_SCHEME or TPMT_ECC_SCHEME
+	if reader.uint16() != tpmAlgNull {
+		reader.uint16() // hashAlg
+	}
+
+	switch pub.algorithm {
+	case tpmAlgRSA:
+		reader.uint16() // keyBits
+		pub.exponent = reader.uint32()
+		pub.modulus = reader.sized()
+	case tpmAlgECC:
+		pub.curveID = reader.uint16()
+		// kdf: TPMT_KDF_SCHEME
+		if reader.uint16() != tpmAlgNull {
+			reader.uint16() // hashAlg
+		}
+		pub.x = reader.sized()
+		pub.y = reader.sized()
+	default:
+		return nil, fmt.Errorf("TPM pubArea algorithm %x is not supported", pub.algorithm)
+	}
+
+	if reader.err != nil {
+		return nil, fmt.Errorf("Could not parse TPM pubArea: %w", reader.err)
+	}
+	return pub, nil
+}
+
+// parseTPMSAttest parses the TPMS_ATTEST structure of certInfo.
+func parseTPMSAttest(data []byte) (*tpmAttest, error) {
+	reader := &tpmReader{data: data}
+	attest := &tpmAttest{}
+
+	attest.magic = reader.uint32()
+	attest.attestType = reader.uint16()
+	reader.sized() // qualifiedSigner
+	attest.extraData = reader.sized()
+	reader.next(17) // clockInfo
+	reader.next(8)  // firmwareVersion
+	attest.attestedName = reader.sized()
+	reader.sized() // attested qualifiedName
+
+	if reader.err != nil {
+		return nil, fmt.Errorf("Could not parse TPM certInfo: %w", reader.err)
+	}
+	return attest, nil
+}
+
+// tpmHash returns the hash function belonging to a TPM algorithm identifier.
+func tpmHash(algorithm uint16) (crypto.Hash, error) {
+	switch algorithm {
+	case tpmAlgSHA1:
+		return crypto.SHA1, nil
+	case tpmAlgSHA256:
+		return crypto.SHA256, nil
+	case tpmAlgSHA384:
+		return crypto.SHA384, nil
+	case tpmAlgSHA512:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("TPM hash algorithm %x is not supported", algorithm)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"testing"
+)
+
+// tpmTestVectors are tpm registrations of Windows Hello and the FIDO conformance tools.
+var tpmTestVectors = []string{"tpm-ecc.json", "tpm-rsa-sha1.json", "tpm-rsa-sha256.json"}
+
+// loadTPMTestStatement reads the attestation statement of a tpm test vector.
+func loadTPMTestStatement(t testing.TB, name string) (*AttestationResponse, *TPMAttestationStatement) {
+	response := loadTestAttestation(t, name)
+
+	var attStmt TPMAttestationStatement
+	err := response.AttestationObject.DecodeAttStmt(&attStmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, &attStmt
+}
+
+func TestTPMAttestation(t *testing.T) {
+	for _, vector := range tpmTestVectors {
+		t.Run(vector, func(t *testing.T) {
+			response := loadTestAttestation(t, vector)
+
+			attestation, err := (&TPMAttestationVerifier{}).Verify(&response.AttestationObject, response.ClientDataHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attestation.Type != AttestationTypeAttCA {
+				t.Fatalf("expected attca attestation, got %s", attestation.Type)
+			}
+			if attestation.Trusted {
+				t.Fatal("expected attestation not to be trusted without metadata")
+			}
+		})
+	}
+}
+
+func TestTPMAttestationOfOtherClientData(t *testing.T) {
+	response := loadTestAttestation(t, "tpm-ecc.json")
+	clientDataHash := append([]byte{}, response.ClientDataHash...)
+	clientDataHash[0] ^= 0xff
+
+	_, err := (&TPMAttestationVerifier{}).Verify(&response.AttestationObject, clientDataHash)
+	if err == nil {
+		t.Fatal("expected attestation of other client data to be rejected")
+	}
+}
+
+func TestParseTPMStructures(t *testing.T) {
+	for _, vector := range tpmTestVectors {
+		t.Run(vector, func(t *testing.T) {
+			_, attStmt := loadTPMTestStatement(t, vector)
+
+			pubArea, err := parseTPMTPublic(attStmt.PubArea)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pubArea.algorithm != tpmAlgRSA && pubArea.algorithm != tpmAlgECC {
+				t.Fatalf("unexpected pubArea algorithm %x", pubArea.algorithm)
+			}
+
+			certInfo, err := parseTPMSAttest(attStmt.CertInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if certInfo.magic != tpmGeneratedValue || certInfo.attestType != tpmStAttestCertify {
+				t.Fatalf("unexpected certInfo magic %x and type %x", certInfo.magic, certInfo.attestType)
+			}
+		})
+	}
+}
+
+func TestParseTruncatedTPMStructures(t *testing.T) {
+	for _, vector := range tpmTestVectors {
+		t.Run(vector, func(t *testing.T) {
+			_, attStmt := loadTPMTestStatement(t, vector)
+
+			for length := 0; length < len(attStmt.PubArea); length++ {
+				_, err := parseTPMTPublic(attStmt.PubArea[:length])
+				if err == nil {
+					t.Fatalf("expected pubArea truncated to %d bytes to be rejected", length)
+				}
+			}
+
+			for length := 0; length < len(attStmt.CertInfo); length++ {
+				_, err := parseTPMSAttest(attStmt.CertInfo[:length])
+				if err == nil {
+					t.Fatalf("expected certInfo truncated to %d bytes to be rejected", length)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMalformedTPMStructures(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) error
+		data  []byte
+	}{
+		{"pubArea with unknown algorithm", parsePubArea, []byte{0x00, 0x08, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x10}},
+		{"pubArea with oversized authPolicy", parsePubArea, []byte{0x00, 0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00}},
+		{"pubArea with oversized modulus", parsePubArea, []byte{0x00, 0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x10, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0x01}},
+		{"pubArea with missing ECC point", parsePubArea, []byte{0x00, 0x23, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x10, 0x00, 0x03, 0x00, 0x10, 0x00, 0x01, 0x01}},
+		{"certInfo with oversized extraData", parseCertInfo, []byte{0xff, 0x54, 0x43, 0x47, 0x80, 0x17, 0x00, 0x00, 0xff, 0xff}},
+		{"certInfo without clockInfo", parseCertInfo, []byte{0xff, 0x54, 0x43, 0x47, 0x80, 0x17, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.parse(test.data) == nil {
+				t.Fatal("expected malformed structure to be rejected")
+			}
+		})
+	}
+}
+
+func TestTPMPubAreaMatchesCredentialPublicKey(t *testing.T) {
+	x, y := []byte{0x01}, []byte{0x02}
+	tests := []struct {
+		name    string
+		pubArea tpmPublic
+		key     PublicKey
+		matches bool
+	}{
+		{"same point", tpmPublic{algorithm: tpmAlgECC, curveID: tpmECCNistP256, x: x, y: y}, &EC2PublicKeyData{Curve: 1, XCoord: x, YCoord: y}, true},
+		{"other curve", tpmPublic{algorithm: tpmAlgECC, curveID: tpmECCNistP384, x: x, y: y}, &EC2PublicKeyData{Curve: 1, XCoord: x, YCoord: y}, false},
+		{"other point", tpmPublic{algorithm: tpmAlgECC, curveID: tpmECCNistP256, x: y, y: x}, &EC2PublicKeyData{Curve: 1, XCoord: x, YCoord: y}, false},
+		// TPM_ECC_BN_P256 is not a COSE curve, the key must not match a credential public key without a curve
+		{"unknown curve", tpmPublic{algorithm: tpmAlgECC, curveID: 0x0010, x: x, y: y}, &EC2PublicKeyData{XCoord: x, YCoord: y}, false},
+		{"RSA pubArea", tpmPublic{algorithm: tpmAlgRSA}, &EC2PublicKeyData{Curve: 1, XCoord: x, YCoord: y}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.pubArea.matches(test.key)
+			if test.matches && err != nil {
+				t.Fatal(err)
+			}
+			if !test.matches && err == nil {
+				t.Fatal("expected pubArea not to match the credential public key")
+			}
+		})
+	}
+}
+
+func parsePubArea(data []byte) error {
+	_, err := parseTPMTPublic(data)
+	return err
+}
+
+func parseCertInfo(data []byte) error {
+	_, err := parseTPMSAttest(data)
+	return err
+}
+
+func FuzzParseTPMTPublic(f *testing.F) {
+	for _, vector := range tpmTestVectors {
+		_, attStmt := loadTPMTestStatement(f, vector)
+		f.Add(attStmt.PubArea)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseTPMTPublic(data)
+	})
+}
+
+func FuzzParseTPMSAttest(f *testing.F) {
+	for _, vector := range tpmTestVectors {
+		_, attStmt := loadTPMTestStatement(f, vector)
+		f.Add(attStmt.CertInfo)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseTPMSAttest(data)
+	})
+}
@@ -1,17 +1,73 @@
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// UserHandleLength is the number of random bytes in a user handle, the maximum allowed by the specification.
+// See https://w3c.github.io/webauthn/#user-handle
+const UserHandleLength = 64
 
 type Credential struct {
-	Id         []byte
-	PublicKey  PublicKey
-	Type       string
-	Transports []string
+	Id              []byte
+	PublicKey       PublicKey
+	Type            string
+	Transports      []string
+	AttestationType AttestationType
+	SignCount       uint32
+	// Set when the signature counter indicated that the authenticator may have been cloned
+	CloneWarning bool
+	// Whether the credential may be backed up; this can not change over the lifetime of a credential.
+	// It is nil for credentials registered before it was recorded and is learned at their next login.
+	BackupEligible *bool
+	// Whether the credential was backed up at the last ceremony
+	BackupState bool
 }
 
 type User struct {
+	// Opaque random handle sent to authenticators as user.id; it must not contain personal information
+	Handle []byte
+	// Unique name the user identifies with, e.g. an e-mail address
 	Identifier  string
+	DisplayName string
 	Credentials []Credential
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// NewUserHandle creates a random user handle.
+func NewUserHandle() ([]byte, error) {
+	handle := make([]byte, UserHandleLength)
+	_, err := rand.Read(handle)
+	if err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// FindCredential returns the credential of the user with the given id, or nil if the user has no such credential.
+func (user *User) FindCredential(id []byte) *Credential {
+	for i := 0; i < len(user.Credentials); i++ {
+		if bytes.Equal(user.Credentials[i].Id, id) {
+			return &user.Credentials[i]
+		}
+	}
+	return nil
+}
+
+// HasBackedUpCredential tells whether at least one credential of the user is backed up, so losing a
+// single authenticator does not lock the user out.
+func (user *User) HasBackedUpCredential() bool {
+	for i := 0; i < len(user.Credentials); i++ {
+		if user.Credentials[i].BackupState {
+			return true
+		}
+	}
+	return false
 }
 
 func (user *User) AllowedCredentials() []AllowCredentialResponse {
@@ -28,24 +84,123 @@ func (user *User) AllowedCredentials() []AllowCredentialResponse {
 
 type UserRepository interface {
 	FindByIdentifier(identifier string) (*User, error)
+	FindByHandle(handle []byte) (*User, error)
+	// FindByCredentialId returns the user owning the credential with the given id
+	FindByCredentialId(id []byte) (*User, error)
 	Create(user *User) error
+	// AddCredential stores an additional credential for an existing user
+	AddCredential(user *User, credential *Credential) error
+	UpdateCredential(credential *Credential) error
 }
 
 type InMemoryUserRepository struct {
+	mutex      sync.RWMutex
 	knownUsers []*User
 }
 
+// FindByIdentifier returns a copy of the stored user, so callers can modify it without
+// affecting concurrent requests. Changes are stored with UpdateCredential.
 func (repo *InMemoryUserRepository) FindByIdentifier(identifier string) (*User, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
 	for i := 0; i < len(repo.knownUsers); i++ {
 		if identifier == repo.knownUsers[i].Identifier {
-			return repo.knownUsers[i], nil
+			return repo.knownUsers[i].copy(), nil
 		}
 	}
 
 	return nil, fmt.Errorf("No user with identifier '%s' found", identifier)
 }
 
+func (repo *InMemoryUserRepository) FindByHandle(handle []byte) (*User, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		if bytes.Equal(handle, repo.knownUsers[i].Handle) {
+			return repo.knownUsers[i].copy(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("No user with handle '%x' found", handle)
+}
+
+func (repo *InMemoryUserRepository) FindByCredentialId(id []byte) (*User, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		if repo.knownUsers[i].FindCredential(id) != nil {
+			return repo.knownUsers[i].copy(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("No user with credential '%x' found", id)
+}
+
 func (repo *InMemoryUserRepository) Create(user *User) error {
-	repo.knownUsers = append(repo.knownUsers, user)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		if user.Identifier == repo.knownUsers[i].Identifier {
+			return fmt.Errorf("User with identifier '%s' already exists", user.Identifier)
+		}
+	}
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	repo.knownUsers = append(repo.knownUsers, user.copy())
 	return nil
 }
+
+func (repo *InMemoryUserRepository) AddCredential(user *User, credential *Credential) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		if repo.knownUsers[i].FindCredential(credential.Id) != nil {
+			return fmt.Errorf("Credential with id '%x' already exists", credential.Id)
+		}
+	}
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		if bytes.Equal(user.Handle, repo.knownUsers[i].Handle) {
+			repo.knownUsers[i].Credentials = append(repo.knownUsers[i].Credentials, *credential)
+			repo.knownUsers[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("No user with handle '%x' found", user.Handle)
+}
+
+func (repo *InMemoryUserRepository) UpdateCredential(credential *Credential) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for i := 0; i < len(repo.knownUsers); i++ {
+		stored := repo.knownUsers[i].FindCredential(credential.Id)
+		if stored != nil {
+			*stored = *credential
+			return nil
+		}
+	}
+
+	return fmt.Errorf("No credential with id '%x' found", credential.Id)
+}
+
+func (user *User) copy() *User {
+	credentials := make([]Credential, len(user.Credentials))
+	copy(credentials, user.Credentials)
+	return &User{
+		Handle:      user.Handle,
+		Identifier:  user.Identifier,
+		DisplayName: user.DisplayName,
+		Credentials: credentials,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUserRepositoryConcurrentAccess(t *testing.T) {
+	repo := &InMemoryUserRepository{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			identifier := fmt.Sprintf("user-%d", i)
+			err := repo.Create(&User{
+				Identifier:  identifier,
+				Credentials: []Credential{{Id: []byte(identifier)}},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			user, err := repo.FindByIdentifier(identifier)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			user.Credentials[0].SignCount = 1
+			err = repo.UpdateCredential(&user.Credentials[0])
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 100; i++ {
+		user, err := repo.FindByIdentifier(fmt.Sprintf("user-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Credentials[0].SignCount != 1 {
+			t.Fatalf("expected sign count of %s to be updated", user.Identifier)
+		}
+	}
+}
+
+func TestFoundUserIsACopy(t *testing.T) {
+	repo := &InMemoryUserRepository{}
+	repo.Create(&User{Identifier: "user", Credentials: []Credential{{Id: []byte("credential")}}})
+
+	user, _ := repo.FindByIdentifier("user")
+	user.Credentials[0].SignCount = 5
+
+	stored, _ := repo.FindByIdentifier("user")
+	if stored.Credentials[0].SignCount != 0 {
+		t.Fatal("modifying a found user changed the stored user")
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+// UserVerificationConfig sets the user verification requirement per ceremony. Only "required" makes
+// ceremonies fail if the authenticator did not verify the user.
+type UserVerificationConfig struct {
+	// Used when registering new and additional credentials; defaults to "preferred"
+	Registration UserVerificationRequirement `json:"registration"`
+	// Used when logging in; defaults to "preferred"
+	Authentication UserVerificationRequirement `json:"authentication"`
+}
+
+func (config *UserVerificationConfig) validate() error {
+	err := config.Registration.validate()
+	if err != nil {
+		return err
+	}
+	return config.Authentication.validate()
+}
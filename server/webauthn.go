@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"time"
 )
 
 type RelyingParty struct {
@@ -16,187 +20,606 @@ type PublicKeyCredentialParameter struct {
 	Type      string `json:"type"`
 }
 
+// ErrUnsupportedCredentialAlgorithm the credential public key does not use one of the requested algorithms
+var ErrUnsupportedCredentialAlgorithm = errors.New("Credential algorithm was not requested")
+
+// ErrCredentialAlreadyRegistered the user tried to register a credential that is already registered
+var ErrCredentialAlreadyRegistered = errors.New("Credential is already registered")
+
 type WebAuthn struct {
-	challengeRepo   ChallengeRepository
-	relyingParty    *RelyingParty
-	authenticator   string // convert to enum
-	credentialTypes []*PublicKeyCredentialParameter
+	userRepo           UserRepository
+	challengeRepo      ChallengeRepository
+	usernamelessRepo   ChallengeRepository
+	challengeGenerator *ChallengeGenerator
+	challengeTimeout   int32
+	conditionalTimeout int32
+	relyingParty       *RelyingParty
+	authenticator      string // convert to enum
+	residentKey        ResidentKeyRequirement
+	origins            *OriginConfig
+	userVerification   *UserVerificationConfig
+	extensions         *ExtensionsConfig
+	credentialTypes    []*PublicKeyCredentialParameter
+	attestationFormats AttestationFormats
+	conveyance         AttestationConveyancePreference
+	requireAttestation bool
+	metadata           MetadataService
+	registrationPolicy *RegistrationPolicyConfig
+	signCountPolicy    SignCountPolicy
+	auditLogger        AuditLogger
 }
 
-func CreateWebAuthn(relyingParty *RelyingParty, authenticator string, credentialTypes []*PublicKeyCredentialParameter, challengeRepo ChallengeRepository) *WebAuthn {
+func CreateWebAuthn(config *Config, userRepo UserRepository, challengeRepo ChallengeRepository) *WebAuthn {
 	return &WebAuthn{
-		relyingParty:    relyingParty,
-		authenticator:   authenticator,
-		credentialTypes: credentialTypes,
-		challengeRepo:   challengeRepo,
+		userRepo:           userRepo,
+		relyingParty:       &config.RelyingParty,
+		authenticator:      config.Authenticator,
+		residentKey:        config.ResidentKey,
+		origins:            &config.Origins,
+		userVerification:   &config.UserVerification,
+		extensions:         &config.Extensions,
+		credentialTypes:    config.PublicKeyCredentialParams,
+		challengeRepo:      challengeRepo,
+		usernamelessRepo:   NewInMemoryChallengeRepository(config.Challenge.MaxOutstandingUsernameless),
+		challengeGenerator: NewChallengeGenerator(config.Challenge.Length),
+		challengeTimeout:   config.Challenge.Timeout,
+		conditionalTimeout: config.Challenge.ConditionalTimeout,
+		attestationFormats: DefaultAttestationFormats(),
+		conveyance:         config.Attestation.Conveyance,
+		requireAttestation: config.Attestation.RequireAttestation,
+		registrationPolicy: &config.RegistrationPolicy,
+		signCountPolicy:    config.SignCountPolicy,
+		auditLogger:        &StdoutAuditLogger{},
 	}
 }
 
-func (webauthn *WebAuthn) BeginRegister(user *User) interface{} {
-	challenge := GenerateChallenge()
+// RegisterAttestationFormat makes registrations using the given attestation statement format verifiable.
+func (webauthn *WebAuthn) RegisterAttestationFormat(format string, verifier AttestationVerifier) {
+	webauthn.attestationFormats.Register(format, verifier)
+}
+
+// UseMetadataService enables trust decisions based on the metadata of authenticator models.
+func (webauthn *WebAuthn) UseMetadataService(metadata MetadataService) {
+	webauthn.metadata = metadata
+}
+
+// UseAuditLogger replaces the logger audit events are recorded with.
+func (webauthn *WebAuthn) UseAuditLogger(auditLogger AuditLogger) {
+	webauthn.auditLogger = auditLogger
+}
+
+// UseUsernamelessChallengeRepository replaces the repository challenges of logins without an identifier,
+// including conditional mediation, are stored in. They are kept apart from the challenges of ceremonies for
+// an identifier, so requests without an identifier can not exhaust the limit of registrations and logins.
+func (webauthn *WebAuthn) UseUsernamelessChallengeRepository(repo ChallengeRepository) {
+	webauthn.usernamelessRepo = repo
+}
+
+// UseChallengeSource replaces the source random challenges are read from, e.g. to create deterministic challenges.
+func (webauthn *WebAuthn) UseChallengeSource(source io.Reader) {
+	webauthn.challengeGenerator.source = source
+}
+
+func (webauthn *WebAuthn) BeginRegister(user *User) (interface{}, error) {
+	challenge, err := webauthn.challengeGenerator.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Handle == nil {
+		user.Handle, err = NewUserHandle()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	response := RegisterResponse{
 		Challenge:                      challenge,
 		RelyingParty:                   webauthn.relyingParty,
-		User:                           &UserResponse{Id: user.Identifier, Name: user.Identifier, DisplayName: user.Identifier},
+		User:                           &UserResponse{Id: user.Handle, Name: user.Identifier, DisplayName: user.DisplayName},
 		PublicKeyCredentialsParameters: webauthn.credentialTypes,
-		AuthenticatorSelection: &AuthenticatorSelectionResponse{
-			AuthenticatorAttachment: webauthn.authenticator,
-		},
-		Timeout:     60000,
-		Attestation: "direct",
+		AuthenticatorSelection:         webauthn.authenticatorSelection(),
+		Timeout:                        webauthn.challengeTimeout,
+		Attestation:                    webauthn.conveyance,
+		Extensions:                     webauthn.extensions.Registration,
 	}
 
-	webauthn.challengeRepo.Create(&Challenge{
-		Value:    challenge,
-		Response: response,
+	err = webauthn.storeSession(&SessionData{
+		Kind:             CeremonyRegistration,
+		Challenge:        challenge,
+		UserHandle:       user.Handle,
+		UserName:         user.Identifier,
+		UserDisplayName:  user.DisplayName,
+		UserVerification: webauthn.userVerification.Registration,
+		Extensions:       webauthn.extensions.Registration,
 	})
-	return response
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
-func (webauthn *WebAuthn) BeginLogin(user *User) interface{} {
-	challenge := GenerateChallenge()
+func (webauthn *WebAuthn) BeginLogin(user *User) (interface{}, error) {
+	challenge, err := webauthn.challengeGenerator.Generate()
+	if err != nil {
+		return nil, err
+	}
 
 	response := LoginResponse{
 		Challenge:        challenge,
 		RelyingPartyId:   webauthn.relyingParty.Id,
 		AllowCredentials: user.AllowedCredentials(),
-		Timeout:          60000,
+		Timeout:          webauthn.challengeTimeout,
+		UserVerification: webauthn.userVerification.Authentication,
+		Extensions:       webauthn.extensions.Authentication,
 	}
 
-	webauthn.challengeRepo.Create(&Challenge{
-		Value:    challenge,
-		Response: response,
+	allowedCredentialIds := [][]byte{}
+	for _, credential := range response.AllowCredentials {
+		allowedCredentialIds = append(allowedCredentialIds, credential.Id)
+	}
+
+	err = webauthn.storeSession(&SessionData{
+		Kind:                 CeremonyAuthentication,
+		Challenge:            challenge,
+		UserHandle:           user.Handle,
+		AllowedCredentialIds: allowedCredentialIds,
+		UserVerification:     webauthn.userVerification.Authentication,
+		Extensions:           webauthn.extensions.Authentication,
 	})
-	return response
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
-func (webauthn *WebAuthn) FinishRegister(registerRequest RegisterRequest) (*User, error) {
-	challengeId, _ := base64.RawStdEncoding.DecodeString(registerRequest.Response.ClientData.Challenge)
-	challenge, _ := webauthn.challengeRepo.FindByValue(string(challengeId))
+// BeginDiscoverableLogin starts a login without a known user. The authenticator offers its discoverable
+// credentials and the user is identified by the returned user handle.
+func (webauthn *WebAuthn) BeginDiscoverableLogin() (interface{}, error) {
+	return webauthn.beginLoginWithoutUser(webauthn.challengeTimeout)
+}
 
-	// Implementation of https://w3c.github.io/webauthn/#sctn-registering-a-new-credential
-	r := (challenge.Response.(RegisterResponse))
-	err := webauthn.verifyCreateCredentials(&r, registerRequest.Response)
+// BeginConditionalLogin starts a login for conditional mediation, where the browser offers discoverable
+// credentials in the autofill of the sign-in form. The challenge lives longer, as the form may stay open.
+func (webauthn *WebAuthn) BeginConditionalLogin() (interface{}, error) {
+	return webauthn.beginLoginWithoutUser(webauthn.conditionalTimeout)
+}
+
+func (webauthn *WebAuthn) beginLoginWithoutUser(timeout int32) (interface{}, error) {
+	challenge, err := webauthn.challengeGenerator.Generate()
 	if err != nil {
 		return nil, err
 	}
 
-	webauthn.challengeRepo.DeleteByValue(string(challengeId))
+	response := LoginResponse{
+		Challenge:        challenge,
+		RelyingPartyId:   webauthn.relyingParty.Id,
+		AllowCredentials: []AllowCredentialResponse{},
+		Timeout:          timeout,
+		UserVerification: webauthn.userVerification.Authentication,
+		Extensions:       webauthn.extensions.Authentication,
+	}
+
+	err = webauthn.storeSessionWithTimeout(webauthn.usernamelessRepo, timeout, &SessionData{
+		Kind:             CeremonyAuthentication,
+		Challenge:        challenge,
+		UserVerification: webauthn.userVerification.Authentication,
+		Extensions:       webauthn.extensions.Authentication,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (webauthn *WebAuthn) authenticatorSelection() *AuthenticatorSelectionResponse {
+	return &AuthenticatorSelectionResponse{
+		AuthenticatorAttachment: webauthn.authenticator,
+		ResidentKey:             webauthn.residentKey,
+		RequireResidentKey:      webauthn.residentKey == ResidentKeyRequired,
+		UserVerification:        webauthn.userVerification.Registration,
+	}
+}
+
+// storeSession remembers the state of the ceremony until its challenge is used or expires.
+func (webauthn *WebAuthn) storeSession(session *SessionData) error {
+	return webauthn.storeSessionWithTimeout(webauthn.challengeRepo, webauthn.challengeTimeout, session)
+}
+
+// storeSessionWithTimeout remembers the state of the ceremony in the repository for the given milliseconds.
+func (webauthn *WebAuthn) storeSessionWithTimeout(repo ChallengeRepository, timeout int32, session *SessionData) error {
+	session.IssuedAt = time.Now()
+	session.Expires = session.IssuedAt.Add(time.Duration(timeout) * time.Millisecond)
+
+	return repo.Create(&Challenge{
+		Value:   string(session.Challenge),
+		Session: session,
+	})
+}
+
+// ConsumeSession returns the state of the ceremony the client data was created for and deletes it, so
+// each challenge can only be used once, no matter whether the ceremony succeeds.
+func (webauthn *WebAuthn) ConsumeSession(clientData ClientData, kind CeremonyKind) (*SessionData, error) {
+	challengeId, err := decodeChallenge(clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := webauthn.challengeRepo.FindAndDeleteByValue(challengeId)
+	if errors.Is(err, ErrChallengeNotFound) && kind == CeremonyAuthentication {
+		challenge, err = webauthn.usernamelessRepo.FindAndDeleteByValue(challengeId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = challenge.Session.Verify(kind, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return challenge.Session, nil
+}
+
+func (webauthn *WebAuthn) FinishRegister(registerRequest RegisterRequest) (*User, error) {
+	session, err := webauthn.ConsumeSession(registerRequest.Response.ClientData, CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := webauthn.createCredential(session, session.UserName, registerRequest)
+	if err != nil {
+		return nil, err
+	}
 
 	return &User{
-		Identifier: r.User.Name,
-		Credentials: []Credential{
-			{
-				Id:         registerRequest.Response.AttestationObject.AuthnData.AttData.CredentialID,
-				PublicKey:  registerRequest.Response.PublicKey,
-				Type:       "public-key",
-				Transports: []string{"platform"},
-			},
-		},
+		Handle:      session.UserHandle,
+		Identifier:  session.UserName,
+		DisplayName: session.UserDisplayName,
+		Credentials: []Credential{*credential},
 	}, nil
 }
 
-func (webauthn *WebAuthn) verifyCreateCredentials(challenge *RegisterResponse, attestationResponse AttestationResponse) error {
-	if challenge == nil {
-		return fmt.Errorf("No valid challenge found")
+// BeginAddCredential starts the registration of an additional credential for an authenticated user.
+// The existing credentials of the user are excluded, so the same authenticator is not registered twice.
+func (webauthn *WebAuthn) BeginAddCredential(user *User) (interface{}, error) {
+	challenge, err := webauthn.challengeGenerator.Generate()
+	if err != nil {
+		return nil, err
 	}
 
-	err := webauthn.verifyClientData(attestationResponse.ClientData)
+	response := RegisterResponse{
+		Challenge:                      challenge,
+		RelyingParty:                   webauthn.relyingParty,
+		User:                           &UserResponse{Id: user.Handle, Name: user.Identifier, DisplayName: user.DisplayName},
+		PublicKeyCredentialsParameters: webauthn.credentialTypes,
+		AuthenticatorSelection:         webauthn.authenticatorSelection(),
+		Timeout:                        webauthn.challengeTimeout,
+		Attestation:                    webauthn.conveyance,
+		ExcludeCredentials:             user.AllowedCredentials(),
+		Extensions:                     webauthn.extensions.Registration,
+	}
+
+	err = webauthn.storeSession(&SessionData{
+		Kind:             CeremonyAddCredential,
+		Challenge:        challenge,
+		UserHandle:       user.Handle,
+		UserVerification: webauthn.userVerification.Registration,
+		Extensions:       webauthn.extensions.Registration,
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return response, nil
+}
 
-	// TODO: Check attstObj.AuthnData
-	// TODO: Check flags
-	// TODO: Check algorithm
+// FinishAddCredential verifies the registration of an additional credential for the authenticated user.
+// It returns the new credential, which has to be stored by the caller.
+func (webauthn *WebAuthn) FinishAddCredential(registerRequest RegisterRequest, user *User) (*Credential, error) {
+	session, err := webauthn.ConsumeSession(registerRequest.Response.ClientData, CeremonyAddCredential)
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO: Implemented https://w3c.github.io/webauthn/#sctn-fido-u2f-attestation
+	if !bytes.Equal(session.UserHandle, user.Handle) {
+		return nil, ErrUserHandleMismatch
+	}
 
-	err = webauthn.verifyKeyAlgorithm(attestationResponse)
+	return webauthn.createCredential(session, user.Identifier, registerRequest)
+}
+
+// createCredential implements https://w3c.github.io/webauthn/#sctn-registering-a-new-credential
+func (webauthn *WebAuthn) createCredential(session *SessionData, identifier string, registerRequest RegisterRequest) (*Credential, error) {
+	attestation, err := webauthn.verifyCreateCredentials(session, registerRequest.Response, registerRequest.ClientExtensionResults)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = webauthn.verifySignature(attestationResponse)
+	// Step 22: The credential must not be registered for any user yet
+	_, err = webauthn.userRepo.FindByCredentialId(registerRequest.Response.AttestationObject.AuthnData.AttData.CredentialID)
+	if err == nil {
+		return nil, ErrCredentialAlreadyRegistered
+	}
+
+	err = webauthn.registrationPolicy.For(identifier).Evaluate(registerRequest.Response.AttestationObject.AuthnData.AttData.AAGUID, attestation)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	backupEligible := registerRequest.Response.AttestationObject.AuthnData.Flags.BackupEligible()
+	return &Credential{
+		Id:              registerRequest.Response.AttestationObject.AuthnData.AttData.CredentialID,
+		PublicKey:       registerRequest.Response.PublicKey,
+		Type:            "public-key",
+		Transports:      []string{"platform"},
+		AttestationType: attestation.Type,
+		SignCount:       registerRequest.Response.AttestationObject.AuthnData.Counter,
+		BackupEligible:  &backupEligible,
+		BackupState:     registerRequest.Response.AttestationObject.AuthnData.Flags.BackupState(),
+	}, nil
 }
 
-func (webauthn *WebAuthn) verifyClientData(clientData ClientData) error {
-	if clientData.Type != webAuthnCreate {
-		return fmt.Errorf("Response type is not 'webauthn.create'; instead found: '%s'", clientData.Type)
+func (webauthn *WebAuthn) verifyCreateCredentials(session *SessionData, attestationResponse AttestationResponse, clientExtensionResults map[string]interface{}) (*AttestationResult, error) {
+	err := webauthn.verifyClientData(attestationResponse.ClientData)
+	if err != nil {
+		return nil, err
 	}
 
-	if !strings.Contains(clientData.Origin, webauthn.relyingParty.Id) {
-		return fmt.Errorf("Origin is not allowed; got '%s'", clientData.Origin)
+	err = session.VerifyChallenge(attestationResponse.ClientData)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	err = webauthn.verifyAuthenticatorData(attestationResponse.AttestationObject.AuthnData, session.UserVerificationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.VerifyExtensions(clientExtensionResults, &attestationResponse.AttestationObject.AuthnData)
+	if err != nil {
+		return nil, err
+	}
+
+	err = webauthn.verifyCredentialAlgorithm(attestationResponse.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation, err := webauthn.attestationFormats.Verify(&attestationResponse.AttestationObject, attestationResponse.ClientDataHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if attestation.Type == AttestationTypeNone && webauthn.requireAttestation {
+		return nil, ErrAttestationRequired
+	}
+
+	err = webauthn.verifyAttestationTrust(&attestationResponse.AttestationObject, attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 24: An attestation that can not be traced back to a trusted root is treated as self attestation
+	attestation.Type = attestation.VerifiedType()
+
+	return attestation, nil
 }
 
-func (webauthn *WebAuthn) verifyKeyAlgorithm(attestationResponse AttestationResponse) error {
-	if attestationResponse.PublicKey.GetAlgorithm() != attestationResponse.AttestationObject.AttStmt.Algorithm {
-		return fmt.Errorf("Algorithms do not match %d != %d", attestationResponse.PublicKey.GetAlgorithm(), attestationResponse.AttestationObject.AttStmt.Algorithm)
+// verifyAttestationTrust validates the trust path of the attestation against the attestation root certificates
+// the metadata service knows for the authenticator model. Attestations of unknown authenticator models stay
+// untrusted, unless the verifier of their format checked them against configured roots.
+// See https://w3c.github.io/webauthn/#sctn-registering-a-new-credential step 23
+func (webauthn *WebAuthn) verifyAttestationTrust(attestationObject *AttestationObject, attestation *AttestationResult) error {
+	if webauthn.metadata == nil || len(attestation.TrustPath) == 0 {
+		return nil
+	}
+
+	entry := webauthn.metadata.FindByAAGUID(attestationObject.AuthnData.AttData.AAGUID)
+	if entry == nil {
+		entry = webauthn.metadata.FindByAttestationCertificate(attestation.TrustPath[0])
+	}
+	if entry == nil {
+		// An unknown model does not become trusted because it claims to be an authenticator
+		return nil
+	}
+	attestation.Metadata = entry
+
+	roots, err := entry.RootCertificates()
+	if err != nil {
+		return err
+	}
+
+	err = verifyCertificateChain(attestation.TrustPath, roots, time.Now())
+	if err != nil {
+		return err
+	}
+	attestation.Trusted = true
+
+	// The attestation statement alone can not tell basic attestation and attestation CAs apart
+	if attestation.Type == AttestationTypeBasic && entry.supportsAttestationType("attca") && !entry.supportsAttestationType("basic_full") {
+		attestation.Type = AttestationTypeAttCA
 	}
 
 	return nil
 }
 
-func (webauthn *WebAuthn) verifySignature(attestationResponse AttestationResponse) error {
-	ok, err := attestationResponse.PublicKey.Verify(attestationResponse.VerificationData, attestationResponse.AttestationObject.AttStmt.Signature)
+// verifyAuthenticatorData checks the RP ID hash and the flags of the authenticator data of a new credential.
+func (webauthn *WebAuthn) verifyAuthenticatorData(authData AuthenticatorData, userVerificationRequired bool) error {
+	rpIdHash := sha256.Sum256([]byte(webauthn.relyingParty.Id))
+	err := authData.Verify(rpIdHash[:], nil, userVerificationRequired)
 	if err != nil {
 		return err
 	}
-	if !ok {
-		return fmt.Errorf("Something went wrong")
+
+	if !authData.Flags.HasAttestedCredentialData() {
+		return ErrMissingAttestedCredentialData
 	}
+
 	return nil
 }
 
-func (webauthn *WebAuthn) FinishLogin(loginRequest *LoginRequest, loginResponse *LoginResponse, user *User) error {
-	var publicKey PublicKey
-	for i := 0; i < len(user.Credentials); i++ {
-		if string(user.Credentials[i].Id) == string(loginRequest.RawId) {
-			publicKey = user.Credentials[i].PublicKey
+// verifyCredentialAlgorithm checks that the credential public key uses one of the requested algorithms.
+func (webauthn *WebAuthn) verifyCredentialAlgorithm(publicKey PublicKey) error {
+	if publicKey == nil {
+		return ErrUnsupportedCredentialAlgorithm
+	}
+
+	for _, credentialType := range webauthn.credentialTypes {
+		if int(credentialType.Algorithm) == publicKey.GetAlgorithm() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrUnsupportedCredentialAlgorithm, publicKey.GetAlgorithm())
+}
+
+func (webauthn *WebAuthn) verifyClientData(clientData ClientData) error {
+	if clientData.Type != webAuthnCreate {
+		return fmt.Errorf("Response type is not 'webauthn.create'; instead found: '%s'", clientData.Type)
+	}
+
+	return webauthn.verifyOrigin(clientData)
+}
+
+// Errors reported when verifying an assertion
+var (
+	ErrCredentialNotAllowed  = errors.New("Credential is not allowed for this login")
+	ErrUnknownCredential     = errors.New("Credential is not known for this user")
+	ErrUserHandleMismatch    = errors.New("User handle does not belong to the user")
+	ErrMissingUserHandle     = errors.New("User handle is required to identify the user")
+	ErrInvalidClientDataType = errors.New("Client data type is invalid")
+	ErrChallengeMismatch     = errors.New("Challenge does not match")
+	ErrInvalidOrigin         = errors.New("Origin is not allowed")
+	ErrInvalidSignature      = errors.New("Signature is invalid")
+)
+
+// FinishLogin implements https://w3c.github.io/webauthn/#sctn-verifying-assertion
+// It returns the used credential with its updated state, which has to be stored by the caller.
+func (webauthn *WebAuthn) FinishLogin(loginRequest *LoginRequest, session *SessionData, user *User) (*Credential, error) {
+	response := &loginRequest.Response
+
+	// Step 5: If options.allowCredentials is not empty, verify that credential.id identifies one of the
+	// public key credentials listed in options.allowCredentials.
+	if !session.IsCredentialAllowed(loginRequest.RawId) {
+		return nil, ErrCredentialNotAllowed
+	}
+
+	// Step 6: Identify the user being authenticated and verify that this user is the owner of the
+	// public key credential source identified by credential.id.
+	credential := user.FindCredential(loginRequest.RawId)
+	if credential == nil {
+		return nil, ErrUnknownCredential
+	}
+
+	if len(response.UserHandle) > 0 && !bytes.Equal(response.UserHandle, user.Handle) {
+		return nil, ErrUserHandleMismatch
+	}
+
+	// The user was identified before the ceremony, otherwise it is identified by the user handle alone
+	if len(session.UserHandle) > 0 {
+		if !bytes.Equal(user.Handle, session.UserHandle) {
+			return nil, ErrUserHandleMismatch
 		}
+	} else if len(response.UserHandle) == 0 {
+		return nil, ErrMissingUserHandle
 	}
 
-	err := webauthn.verifyClientDataForLogin(&loginRequest.Response)
+	// Steps 10 to 13: Verify type, challenge and origin of the client data.
+	err := webauthn.verifyClientDataForLogin(response, session)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = webauthn.verifySignatureForLogin(&loginRequest.Response, publicKey)
+	// Steps 14 to 17: Verify the RP ID hash and the flags of the authenticator data.
+	rpIdHash := sha256.Sum256([]byte(webauthn.relyingParty.Id))
+	err = response.AuthenticatorData.Verify(rpIdHash[:], nil, session.UserVerificationRequired())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	// Step 18: Only requested extensions may have outputs.
+	err = session.VerifyExtensions(loginRequest.ClientExtensionResults, &response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps 19 to 20: Verify the signature over authenticatorData and the hash of clientDataJSON.
+	err = webauthn.verifySignatureForLogin(response, credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 17: Verify the backup flags and remember the current backup state, once the signature is verified.
+	err = verifyBackupFlags(credential, response.AuthenticatorData.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 21: Compare the signature counter with the stored one to detect cloned authenticators.
+	err = webauthn.verifySignCount(user, credential, response.AuthenticatorData.Counter)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
 }
 
-func (webauthn *WebAuthn) verifyClientDataForLogin(response *AssertionResponse) error {
+func (webauthn *WebAuthn) verifyClientDataForLogin(response *AssertionResponse, session *SessionData) error {
 	if response.ClientData.Type != webAuthnGet {
-		return fmt.Errorf("Response type is not 'webauthn.create'; instead found: '%s'", response.ClientData.Type)
+		return fmt.Errorf("%w: expected '%s', found '%s'", ErrInvalidClientDataType, webAuthnGet, response.ClientData.Type)
 	}
 
-	if !strings.Contains(response.ClientData.Origin, "localhost") {
-		return fmt.Errorf("Origin is not allowed; got '%s'", response.ClientData.Origin)
+	err := session.VerifyChallenge(response.ClientData)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return webauthn.verifyOrigin(response.ClientData)
+}
+
+// verifyOrigin checks the origin of the client data against the allowed origins and the RP ID.
+func (webauthn *WebAuthn) verifyOrigin(clientData ClientData) error {
+	err := webauthn.origins.Verify(clientData)
+	if err != nil {
+		return err
+	}
+
+	return webauthn.relyingParty.VerifyOrigin(clientData.Origin)
 }
 
 func (webauthn *WebAuthn) verifySignatureForLogin(response *AssertionResponse, publicKey PublicKey) error {
+	if publicKey == nil {
+		return ErrUnknownCredential
+	}
+
 	ok, err := publicKey.Verify(response.VerificationData, response.Signature)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
 	}
 	if !ok {
-		return fmt.Errorf("Something went wrong")
+		return ErrInvalidSignature
 	}
 	return nil
 }
+
+// verifyBackupFlags checks that the backup eligibility of the credential did not change and updates its
+// backup state, which may change between ceremonies. An unknown backup eligibility is taken from the flags.
+func verifyBackupFlags(credential *Credential, flags AuthenticatorFlags) error {
+	backupEligible := flags.BackupEligible()
+	if credential.BackupEligible == nil {
+		credential.BackupEligible = &backupEligible
+	} else if *credential.BackupEligible != backupEligible {
+		return ErrBackupEligibilityChanged
+	}
+
+	credential.BackupState = flags.BackupState()
+	return nil
+}
+
+// decodeChallenge returns the challenge the client data was created for. The client data
+// contains the challenge base64url encoded without padding.
+func decodeChallenge(clientData ClientData) (string, error) {
+	challenge, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil {
+		return "", err
+	}
+	return string(challenge), nil
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5173"
+)
+
+// newTestWebAuthn creates a relying party for localhost with the defaults of an empty configuration.
+func newTestWebAuthn(t *testing.T, configure func(config *Config)) *WebAuthn {
+	t.Helper()
+
+	config := &Config{
+		RelyingParty:              RelyingParty{Name: "Test", Id: testRPID},
+		PublicKeyCredentialParams: []*PublicKeyCredentialParameter{{Algorithm: int32(AlgES256), Type: "public-key"}},
+		Origins:                   OriginConfig{Allowed: []string{testOrigin}},
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	for _, validate := range []func() error{
+		config.Challenge.validate,
+		config.ResidentKey.validate,
+		config.UserVerification.validate,
+		config.Origins.validate,
+		config.Attestation.validate,
+		config.RegistrationPolicy.validate,
+		config.SignCountPolicy.validate,
+	} {
+		if err := validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return CreateWebAuthn(config, &InMemoryUserRepository{}, NewInMemoryChallengeRepository(config.Challenge.MaxOutstanding))
+}
+
+// attestationStatementFunc creates the attestation statement for the given authenticator data and client data hash.
+type attestationStatementFunc func(authData []byte, clientDataHash []byte) (string, map[string]interface{})
+
+// noneAttestation creates a none attestation statement.
+func noneAttestation(authData []byte, clientDataHash []byte) (string, map[string]interface{}) {
+	return "none", map[string]interface{}{}
+}
+
+// testAuthenticator is a software authenticator holding a single ES256 credential.
+type testAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	aaguid       []byte
+	counter      uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialId := make([]byte, 32)
+	if _, err := rand.Read(credentialId); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testAuthenticator{t: t, key: key, credentialId: credentialId, aaguid: make([]byte, 16)}
+}
+
+// testCOSECurves are the COSE algorithm and curve identifiers of the curves of test credentials.
+var testCOSECurves = map[elliptic.Curve]struct {
+	algorithm COSEAlgorithmIdentifier
+	curve     int
+}{
+	elliptic.P256(): {AlgES256, 1},
+	elliptic.P384(): {AlgES384, 2},
+	elliptic.P521(): {AlgES512, 3},
+}
+
+// coseKey encodes the credential public key as COSE_Key.
+func (authenticator *testAuthenticator) coseKey() []byte {
+	publicKey := authenticator.key.PublicKey
+	size := (publicKey.Curve.Params().BitSize + 7) / 8
+	encoded, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  int(testCOSECurves[publicKey.Curve].algorithm),
+		-1: testCOSECurves[publicKey.Curve].curve,
+		-2: publicKey.X.FillBytes(make([]byte, size)),
+		-3: publicKey.Y.FillBytes(make([]byte, size)),
+	})
+	if err != nil {
+		authenticator.t.Fatal(err)
+	}
+	return encoded
+}
+
+// authenticatorData creates authenticator data for the test RP ID, with attested credential data if attested is set.
+func (authenticator *testAuthenticator) authenticatorData(flags AuthenticatorFlags, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRPID))
+	authenticator.counter++
+
+	authData := append([]byte{}, rpIdHash[:]...)
+	if attested {
+		flags |= FlagAttestedCredentialData
+	}
+	authData = append(authData, byte(flags))
+	authData = binary.BigEndian.AppendUint32(authData, authenticator.counter)
+
+	if attested {
+		authData = append(authData, authenticator.aaguid...)
+		authData = binary.BigEndian.AppendUint16(authData, uint16(len(authenticator.credentialId)))
+		authData = append(authData, authenticator.credentialId...)
+		authData = append(authData, authenticator.coseKey()...)
+	}
+	return authData
+}
+
+// register creates the response of navigator.credentials.create() for the given challenge.
+func (authenticator *testAuthenticator) register(challenge []byte, flags AuthenticatorFlags, attStmt attestationStatementFunc) RegisterRequest {
+	var request RegisterRequest
+	authenticator.unmarshal(authenticator.registrationBody(challenge, flags, attStmt), &request)
+	return request
+}
+
+// registrationBody creates the JSON body the client sends the response of navigator.credentials.create() with.
+func (authenticator *testAuthenticator) registrationBody(challenge []byte, flags AuthenticatorFlags, attStmt attestationStatementFunc) map[string]interface{} {
+	clientDataJSON := clientDataJSON(webAuthnCreate, challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	authData := authenticator.authenticatorData(flags, true)
+
+	format, statement := attStmt(authData, clientDataHash[:])
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      format,
+		"attStmt":  statement,
+		"authData": authData,
+	})
+	if err != nil {
+		authenticator.t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(authenticator.credentialId),
+		"rawId": base64.RawURLEncoding.EncodeToString(authenticator.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		},
+	}
+}
+
+// login creates the response of navigator.credentials.get() for the given challenge.
+func (authenticator *testAuthenticator) login(challenge []byte, flags AuthenticatorFlags, userHandle []byte) *LoginRequest {
+	var request LoginRequest
+	authenticator.unmarshal(authenticator.loginBody(challenge, flags, userHandle), &request)
+	return &request
+}
+
+// loginBody creates the JSON body the client sends the response of navigator.credentials.get() with.
+func (authenticator *testAuthenticator) loginBody(challenge []byte, flags AuthenticatorFlags, userHandle []byte) map[string]interface{} {
+	clientDataJSON := clientDataJSON(webAuthnGet, challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	authData := authenticator.authenticatorData(flags, false)
+
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, authenticator.key, digest[:])
+	if err != nil {
+		authenticator.t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(authenticator.credentialId),
+		"rawId": base64.RawURLEncoding.EncodeToString(authenticator.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(userHandle),
+		},
+	}
+}
+
+// unmarshal round trips the request through JSON, the way it arrives from the client.
+func (authenticator *testAuthenticator) unmarshal(body interface{}, request interface{}) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		authenticator.t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, request); err != nil {
+		authenticator.t.Fatal(err)
+	}
+}
+
+func clientDataJSON(ceremonyType string, challenge []byte) []byte {
+	encoded, _ := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	return encoded
+}
+
+// registerTestUser runs a registration ceremony for a new user and returns the registered user.
+func registerTestUser(t *testing.T, webauthn *WebAuthn, authenticator *testAuthenticator, attStmt attestationStatementFunc) *User {
+	t.Helper()
+
+	options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := webauthn.FinishRegister(authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, attStmt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRegisterCredentialOfOtherUser(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	alice := registerTestUser(t, webauthn, authenticator, noneAttestation)
+	if err := webauthn.userRepo.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := webauthn.BeginRegister(&User{Identifier: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = webauthn.FinishRegister(authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, noneAttestation))
+	if !errors.Is(err, ErrCredentialAlreadyRegistered) {
+		t.Fatalf("expected ErrCredentialAlreadyRegistered, got %v", err)
+	}
+}
+
+// addTestCredential runs the ceremony adding the credential of the authenticator to the user.
+func addTestCredential(t *testing.T, webauthn *WebAuthn, authenticator *testAuthenticator, user *User) (*Credential, error) {
+	t.Helper()
+
+	options, err := webauthn.BeginAddCredential(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webauthn.FinishAddCredential(authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, noneAttestation), user)
+}
+
+func TestAddCredential(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	user := registerTestUser(t, webauthn, newTestAuthenticator(t), noneAttestation)
+	if err := webauthn.userRepo.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := newTestAuthenticator(t)
+	credential, err := addTestCredential(t, webauthn, authenticator, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(credential.Id, authenticator.credentialId) {
+		t.Fatalf("expected credential %x, got %x", authenticator.credentialId, credential.Id)
+	}
+}
+
+func TestAddCredentialAlreadyRegistered(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	alice := registerTestUser(t, webauthn, authenticator, noneAttestation)
+	if err := webauthn.userRepo.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := addTestCredential(t, webauthn, authenticator, alice)
+	if !errors.Is(err, ErrCredentialAlreadyRegistered) {
+		t.Fatalf("expected ErrCredentialAlreadyRegistered for own credential, got %v", err)
+	}
+
+	bob := &User{Handle: []byte("bob"), Identifier: "bob"}
+	if err := webauthn.userRepo.Create(bob); err != nil {
+		t.Fatal(err)
+	}
+	_, err = addTestCredential(t, webauthn, authenticator, bob)
+	if !errors.Is(err, ErrCredentialAlreadyRegistered) {
+		t.Fatalf("expected ErrCredentialAlreadyRegistered for credential of other user, got %v", err)
+	}
+}
+
+func TestAddCredentialOfOtherSession(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	alice := registerTestUser(t, webauthn, newTestAuthenticator(t), noneAttestation)
+
+	options, err := webauthn.BeginAddCredential(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := newTestAuthenticator(t).register(options.(RegisterResponse).Challenge, FlagUserPresent, noneAttestation)
+	_, err = webauthn.FinishAddCredential(request, &User{Handle: []byte("bob"), Identifier: "bob"})
+	if !errors.Is(err, ErrUserHandleMismatch) {
+		t.Fatalf("expected ErrUserHandleMismatch, got %v", err)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	credential, err := loginTestUser(t, webauthn, authenticator, user, FlagUserPresent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != authenticator.counter {
+		t.Fatalf("expected sign count %d, got %d", authenticator.counter, credential.SignCount)
+	}
+}
+
+// loginTestUser runs a login ceremony of the user with the given authenticator flags and user handle.
+func loginTestUser(t *testing.T, webauthn *WebAuthn, authenticator *testAuthenticator, user *User, flags AuthenticatorFlags, userHandle []byte) (*Credential, error) {
+	t.Helper()
+
+	options, err := webauthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := authenticator.login(options.(LoginResponse).Challenge, flags, userHandle)
+	session, err := webauthn.ConsumeSession(request.Response.ClientData, CeremonyAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webauthn.FinishLogin(request, session, user)
+}
+
+func TestLoginLearnsUnknownBackupEligibility(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+	user.Credentials[0].BackupEligible = nil
+
+	credential, err := loginTestUser(t, webauthn, authenticator, user, FlagUserPresent|FlagBackupEligible|FlagBackupState, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.BackupEligible == nil || !*credential.BackupEligible || !credential.BackupState {
+		t.Fatal("expected backup eligibility and state to be learned from the flags")
+	}
+
+	_, err = loginTestUser(t, webauthn, authenticator, user, FlagUserPresent, nil)
+	if !errors.Is(err, ErrBackupEligibilityChanged) {
+		t.Fatalf("expected ErrBackupEligibilityChanged, got %v", err)
+	}
+}
+
+func TestRegistrationRequiringUserVerification(t *testing.T) {
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.UserVerification.Registration = UserVerificationRequired
+	})
+	authenticator := newTestAuthenticator(t)
+
+	for _, test := range []struct {
+		flags AuthenticatorFlags
+		err   error
+	}{
+		{FlagUserPresent, ErrUserNotVerified},
+		{FlagUserPresent | FlagUserVerified, nil},
+	} {
+		options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = webauthn.FinishRegister(authenticator.register(options.(RegisterResponse).Challenge, test.flags, noneAttestation))
+		if !errors.Is(err, test.err) {
+			t.Fatalf("expected %v with flags %08b, got %v", test.err, test.flags, err)
+		}
+	}
+}
+
+func TestLoginRequiringUserVerification(t *testing.T) {
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.UserVerification.Authentication = UserVerificationRequired
+	})
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	_, err := loginTestUser(t, webauthn, authenticator, user, FlagUserPresent, nil)
+	if !errors.Is(err, ErrUserNotVerified) {
+		t.Fatalf("expected ErrUserNotVerified, got %v", err)
+	}
+
+	_, err = loginTestUser(t, webauthn, authenticator, user, FlagUserPresent|FlagUserVerified, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// discoverableLoginTestUser runs a usernameless login, where the user is only known by the used credential.
+func discoverableLoginTestUser(t *testing.T, webauthn *WebAuthn, authenticator *testAuthenticator, user *User, userHandle []byte) (*Credential, error) {
+	t.Helper()
+
+	options, err := webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := authenticator.login(options.(LoginResponse).Challenge, FlagUserPresent, userHandle)
+	session, err := webauthn.ConsumeSession(request.Response.ClientData, CeremonyAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webauthn.FinishLogin(request, session, user)
+}
+
+func TestDiscoverableLogin(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	_, err := discoverableLoginTestUser(t, webauthn, authenticator, user, user.Handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverableLoginWithoutUserHandle(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	_, err := discoverableLoginTestUser(t, webauthn, authenticator, user, nil)
+	if !errors.Is(err, ErrMissingUserHandle) {
+		t.Fatalf("expected ErrMissingUserHandle, got %v", err)
+	}
+}
+
+func TestDiscoverableLoginWithUserHandleOfOtherUser(t *testing.T) {
+	webauthn := newTestWebAuthn(t, nil)
+	authenticator := newTestAuthenticator(t)
+	user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+	otherHandle, err := NewUserHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = discoverableLoginTestUser(t, webauthn, authenticator, user, otherHandle)
+	if !errors.Is(err, ErrUserHandleMismatch) {
+		t.Fatalf("expected ErrUserHandleMismatch, got %v", err)
+	}
+}
+
+func TestCeremoniesOnlyAcceptRequestedExtensions(t *testing.T) {
+	webauthn := newTestWebAuthn(t, func(config *Config) {
+		config.Extensions.Registration = map[string]interface{}{"credProps": true}
+	})
+	authenticator := newTestAuthenticator(t)
+
+	options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.(RegisterResponse).Extensions["credProps"] != true {
+		t.Fatalf("expected credProps to be requested, got %v", options.(RegisterResponse).Extensions)
+	}
+	request := authenticator.register(options.(RegisterResponse).Challenge, FlagUserPresent, noneAttestation)
+	request.ClientExtensionResults = map[string]interface{}{"credProps": map[string]interface{}{"rk": true}}
+	user, err := webauthn.FinishRegister(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loginOptions, err := webauthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginRequest := authenticator.login(loginOptions.(LoginResponse).Challenge, FlagUserPresent, nil)
+	loginRequest.ClientExtensionResults = map[string]interface{}{"credProps": map[string]interface{}{"rk": true}}
+	session, err := webauthn.ConsumeSession(loginRequest.Response.ClientData, CeremonyAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = webauthn.FinishLogin(loginRequest, session, user)
+	if !errors.Is(err, ErrUnrequestedExtension) {
+		t.Fatalf("expected ErrUnrequestedExtension for an extension only requested at registration, got %v", err)
+	}
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		configure func(config *Config)
+		modify    func(request *RegisterRequest)
+		err       error
+	}{
+		{
+			name: "RP ID hash of other relying party",
+			modify: func(request *RegisterRequest) {
+				rpIdHash := sha256.Sum256([]byte("example.com"))
+				request.Response.AttestationObject.AuthnData.RPIDHash = rpIdHash[:]
+			},
+			err: ErrRPIDHashMismatch,
+		},
+		{
+			name: "user not present",
+			modify: func(request *RegisterRequest) {
+				request.Response.AttestationObject.AuthnData.Flags &^= FlagUserPresent
+			},
+			err: ErrUserNotPresent,
+		},
+		{
+			name: "missing attested credential data",
+			modify: func(request *RegisterRequest) {
+				request.Response.AttestationObject.AuthnData.Flags &^= FlagAttestedCredentialData
+			},
+			err: ErrMissingAttestedCredentialData,
+		},
+		{
+			name: "credential algorithm not requested",
+			configure: func(config *Config) {
+				config.PublicKeyCredentialParams = []*PublicKeyCredentialParameter{{Algorithm: int32(AlgRS256), Type: "public-key"}}
+			},
+			err: ErrUnsupportedCredentialAlgorithm,
+		},
+		{
+			name: "challenge of other ceremony",
+			modify: func(request *RegisterRequest) {
+				request.Response.ClientData.Challenge = base64.RawURLEncoding.EncodeToString([]byte("other challenge"))
+			},
+			err: ErrChallengeMismatch,
+		},
+		{
+			name: "origin not allowed",
+			modify: func(request *RegisterRequest) {
+				request.Response.ClientData.Origin = "https://example.com"
+			},
+			err: ErrInvalidOrigin,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			webauthn := newTestWebAuthn(t, test.configure)
+
+			options, err := webauthn.BeginRegister(&User{Identifier: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := newTestAuthenticator(t).register(options.(RegisterResponse).Challenge, FlagUserPresent, noneAttestation)
+			session, err := webauthn.ConsumeSession(request.Response.ClientData, CeremonyRegistration)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.modify != nil {
+				test.modify(&request)
+			}
+			_, err = webauthn.createCredential(session, "alice", request)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(request *LoginRequest, session *SessionData)
+		err    error
+	}{
+		{
+			name: "RP ID hash of other relying party",
+			modify: func(request *LoginRequest, session *SessionData) {
+				rpIdHash := sha256.Sum256([]byte("example.com"))
+				request.Response.AuthenticatorData.RPIDHash = rpIdHash[:]
+			},
+			err: ErrRPIDHashMismatch,
+		},
+		{
+			name: "user not present",
+			modify: func(request *LoginRequest, session *SessionData) {
+				request.Response.AuthenticatorData.Flags &^= FlagUserPresent
+			},
+			err: ErrUserNotPresent,
+		},
+		{
+			name: "challenge of other ceremony",
+			modify: func(request *LoginRequest, session *SessionData) {
+				request.Response.ClientData.Challenge = base64.RawURLEncoding.EncodeToString([]byte("other challenge"))
+			},
+			err: ErrChallengeMismatch,
+		},
+		{
+			name: "origin not allowed",
+			modify: func(request *LoginRequest, session *SessionData) {
+				request.Response.ClientData.Origin = "https://example.com"
+			},
+			err: ErrInvalidOrigin,
+		},
+		{
+			name: "credential not in allowCredentials",
+			modify: func(request *LoginRequest, session *SessionData) {
+				request.RawId = []byte("other credential")
+			},
+			err: ErrCredentialNotAllowed,
+		},
+		{
+			name: "unknown credential",
+			modify: func(request *LoginRequest, session *SessionData) {
+				session.AllowedCredentialIds = nil
+				request.RawId = []byte("other credential")
+			},
+			err: ErrUnknownCredential,
+		},
+		{
+			name: "invalid signature",
+			modify: func(request *LoginRequest, session *SessionData) {
+				request.Response.Signature[len(request.Response.Signature)-1] ^= 0xff
+			},
+			err: ErrInvalidSignature,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			webauthn := newTestWebAuthn(t, nil)
+			authenticator := newTestAuthenticator(t)
+			user := registerTestUser(t, webauthn, authenticator, noneAttestation)
+
+			options, err := webauthn.BeginLogin(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := authenticator.login(options.(LoginResponse).Challenge, FlagUserPresent, nil)
+			session, err := webauthn.ConsumeSession(request.Response.ClientData, CeremonyAuthentication)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.modify(request, session)
+			_, err = webauthn.FinishLogin(request, session, user)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}